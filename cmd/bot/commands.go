@@ -0,0 +1,807 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/audit"
+	"whatsapp-transcriber-go/internal/commands"
+	"whatsapp-transcriber-go/internal/exclusion"
+	"whatsapp-transcriber-go/internal/identity"
+	"whatsapp-transcriber-go/internal/locale"
+	"whatsapp-transcriber-go/internal/phone"
+	"whatsapp-transcriber-go/internal/settings"
+	"whatsapp-transcriber-go/internal/transcription"
+)
+
+// chatSink replies to the chat a command came from, in the chat's locale.
+type chatSink struct {
+	event *events.Message
+}
+
+func (s chatSink) Reply(key string, data locale.Data) {
+	reply(s.event, key, data)
+}
+
+func (s chatSink) Text(key string, data locale.Data) string {
+	return catalog.Render(chatLocale(s.event.Info.Chat), key, data)
+}
+
+// groupAdminTTL is how long the admins of a group are cached, so commands don't look them up each time.
+const groupAdminTTL = time.Minute
+
+// groupAdmins caches the admins of groups, keyed by group JID.
+var groupAdmins = struct {
+	sync.Mutex
+	groups map[types.JID]cachedAdmins
+}{groups: make(map[types.JID]cachedAdmins)}
+
+// cachedAdmins are the admins of a group as fetched from WhatsApp.
+type cachedAdmins struct {
+	participants []types.GroupParticipant
+	fetched      time.Time
+}
+
+// senderLevel returns the permission level of a message's sender for a command requiring the given
+// level. Group admins are only looked up when the command requires it, since that needs a request to
+// WhatsApp.
+func senderLevel(v *events.Message, required commands.Level) commands.Level {
+	// Admins are configured by phone number, so match the sender by phone number even if addressed by LID
+	source := v.Info.MessageSource
+	source.Sender = resolveSender(v).Phone()
+	if !authorizer.CanManage(source) {
+		if v.Info.IsGroup && required == commands.LevelGroupAdmin && isGroupAdmin(v.Info.Chat, resolveSender(v)) {
+			return commands.LevelGroupAdmin
+		}
+		return commands.LevelAnyone
+	}
+	if v.Info.IsFromMe || authorizer.IsOwner(source.Sender) {
+		return commands.LevelOwner
+	}
+	return commands.LevelAdmin
+}
+
+// canManageChat reports whether the sender of a command may manage the chat it was sent in: anyone in
+// a direct chat, and admins in a group. For handlers whose permission depends on their arguments.
+func canManageChat(c *commands.Context) bool {
+	if !c.Event.Info.IsGroup || c.Level >= commands.LevelGroupAdmin {
+		return true
+	}
+	return isGroupAdmin(c.Event.Info.Chat, resolveSender(c.Event))
+}
+
+// isGroupAdmin reports whether the user is an admin of the group, as reported by WhatsApp.
+func isGroupAdmin(group types.JID, id identity.Identity) bool {
+	for _, participant := range fetchGroupAdmins(group) {
+		for _, jid := range []types.JID{participant.JID, participant.PhoneNumber, participant.LID} {
+			if !jid.IsEmpty() && (jid.User == id.PN.User || jid.User == id.LID.User) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fetchGroupAdmins returns the admins of a group, from the cache if fetched within groupAdminTTL.
+func fetchGroupAdmins(group types.JID) []types.GroupParticipant {
+	groupAdmins.Lock()
+	cached, ok := groupAdmins.groups[group]
+	groupAdmins.Unlock()
+	if ok && time.Since(cached.fetched) < groupAdminTTL {
+		return cached.participants
+	}
+
+	info, err := cli.GetGroupInfo(group)
+	if err != nil {
+		log.Error("Failed to get group info", zap.String("group", group.String()), zap.Error(err))
+		return nil
+	}
+	var admins []types.GroupParticipant
+	for _, participant := range info.Participants {
+		if participant.IsAdmin || participant.IsSuperAdmin {
+			admins = append(admins, participant)
+		}
+	}
+	groupAdmins.Lock()
+	groupAdmins.groups[group] = cachedAdmins{participants: admins, fetched: time.Now()}
+	groupAdmins.Unlock()
+	return admins
+}
+
+// registerCommands registers the bot's chat commands on the router.
+func registerCommands(r *commands.Router) {
+	exclusionList := numberList{manager: exclusionManager, add: "exclude", remove: "include"}
+	allowList := numberList{manager: allowlistManager, add: "allow", remove: "revoke"}
+
+	r.Register(&commands.Command{
+		Name:    "exclude",
+		Aliases: []string{"excluir"},
+		Level:   commands.LevelAdmin,
+		MaxArgs: -1,
+		Handler: exclusionList.addCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "mute",
+		Aliases: []string{"silenciar"},
+		Level:   commands.LevelAdmin,
+		MaxArgs: 1,
+		Handler: exclusionList.muteCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "include",
+		Aliases: []string{"incluir"},
+		Level:   commands.LevelAdmin,
+		MinArgs: 1,
+		MaxArgs: 1,
+		Handler: exclusionList.removeCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "allow",
+		Aliases: []string{"permitir"},
+		Level:   commands.LevelAdmin,
+		MaxArgs: -1,
+		Handler: allowList.addCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "revoke",
+		Aliases: []string{"revogar"},
+		Level:   commands.LevelAdmin,
+		MinArgs: 1,
+		MaxArgs: 1,
+		Handler: allowList.removeCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "stop",
+		Aliases: []string{"parar"},
+		Level:   commands.LevelAnyone,
+		AnyChat: true,
+		Handler: stopCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "start",
+		Aliases: []string{"iniciar"},
+		Level:   commands.LevelAnyone,
+		AnyChat: true,
+		Handler: startCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "retranscribe",
+		Aliases: []string{"retranscrever"},
+		Level:   commands.LevelAdmin,
+		Handler: retranscribeCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "transcribe",
+		Aliases: []string{"t", "transcrever", "transcribir"},
+		Level:   commands.LevelAnyone,
+		AnyChat: true,
+		MaxArgs: 1,
+		Handler: transcribeCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "grant",
+		Aliases: []string{"conceder"},
+		Level:   commands.LevelAdmin,
+		MinArgs: 2,
+		MaxArgs: 2,
+		Handler: grantCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "cancel",
+		Aliases: []string{"cancelar"},
+		Level:   commands.LevelAnyone,
+		AnyChat: true, // On-demand transcriptions can run in chats that are turned off
+		Handler: cancelCommand,
+	})
+	r.Register(&commands.Command{
+		Name:       "reactions",
+		Aliases:    []string{"reacoes"},
+		Level:      commands.LevelAnyone,
+		GroupLevel: commands.LevelGroupAdmin,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Handler:    feedbackCommand,
+	})
+	r.Register(&commands.Command{
+		Name:       "typing",
+		Aliases:    []string{"digitando"},
+		Level:      commands.LevelAnyone,
+		GroupLevel: commands.LevelGroupAdmin,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Handler:    feedbackCommand,
+	})
+	r.Register(&commands.Command{
+		Name:       "locale",
+		Aliases:    []string{"idioma"},
+		Level:      commands.LevelAnyone,
+		GroupLevel: commands.LevelGroupAdmin,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Handler:    localeCommand,
+	})
+	r.Register(&commands.Command{
+		Name:       "style",
+		Aliases:    []string{"estilo"},
+		Level:      commands.LevelAnyone,
+		GroupLevel: commands.LevelGroupAdmin,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Handler:    styleCommand,
+	})
+	r.Register(&commands.Command{
+		Name:       "lang",
+		Aliases:    []string{"lingua"},
+		Level:      commands.LevelAnyone,
+		GroupLevel: commands.LevelGroupAdmin,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Handler:    languageCommand,
+	})
+	r.Register(&commands.Command{
+		Name:       "translate",
+		Aliases:    []string{"traduzir", "traducir"},
+		Level:      commands.LevelAnyone,
+		GroupLevel: commands.LevelGroupAdmin,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Handler:    translateCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "provider",
+		Aliases: []string{"provedor", "proveedor"},
+		Level:   commands.LevelAdmin,
+		MinArgs: 1,
+		MaxArgs: 1,
+		Handler: providerCommand,
+	})
+	r.Register(&commands.Command{
+		Name:       "maxduration",
+		Aliases:    []string{"duracao", "duracion"},
+		Level:      commands.LevelAnyone,
+		GroupLevel: commands.LevelGroupAdmin,
+		MinArgs:    1,
+		MaxArgs:    1,
+		Handler:    maxDurationCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "settings",
+		Aliases: []string{"config"},
+		Level:   commands.LevelAnyone,
+		MaxArgs: 1,
+		Handler: settingsCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "on",
+		Aliases: []string{"ligar"},
+		Level:   commands.LevelGroupAdmin,
+		AnyChat: true,
+		Handler: enableCommand,
+	})
+	r.Register(&commands.Command{
+		Name:    "off",
+		Aliases: []string{"desligar"},
+		Level:   commands.LevelGroupAdmin,
+		Handler: enableCommand,
+	})
+}
+
+// numberList binds a phone number list to the commands that manage it. Replies are rendered
+// from the "<add>.*" and "<remove>.*" message keys.
+type numberList struct {
+	manager *exclusion.Manager
+	add     string // Name of the command adding and listing numbers
+	remove  string // Name of the command removing numbers
+}
+
+// addCommand lists the numbers on the list, or adds the given number, optionally for a duration and
+// with a reason: /exclude <number> [duration] [reason...].
+func (l numberList) addCommand(c *commands.Context) {
+	if len(c.Args) == 0 {
+		entries := l.manager.Entries()
+		if len(entries) == 0 {
+			c.Reply(l.add+".empty", nil)
+			return
+		}
+		var numbers []locale.Data
+		for _, entry := range entries {
+			remaining := ""
+			if !entry.Expires.IsZero() {
+				remaining = commands.FormatDuration(time.Until(entry.Expires))
+			}
+			numbers = append(numbers, locale.Data{
+				"Number":    entry.JID,
+				"Remaining": remaining,
+				"Reason":    entry.Reason,
+				"Author":    entry.Author,
+			})
+		}
+		c.Reply(l.add+".list", locale.Data{"Numbers": numbers})
+		return
+	}
+
+	var duration time.Duration
+	reason := c.Args[1:]
+	// An argument starting with a digit is a duration; anything else starts the reason
+	if len(reason) > 0 && reason[0][0] >= '0' && reason[0][0] <= '9' {
+		var err error
+		if duration, err = commands.ParseDuration(reason[0]); err != nil {
+			c.Reply("exclude.invalid_duration", locale.Data{"Duration": reason[0]})
+			return
+		}
+		reason = reason[1:]
+	}
+	entry, err := exclusionEntry(l.manager, c.Args[0])
+	if err != nil {
+		c.Reply("exclude.invalid", locale.Data{"Number": c.Args[0]})
+		return
+	}
+	l.addEntry(c, entry, c.Args[0], duration, strings.Join(reason, " "))
+}
+
+// addEntry adds an entry to the list, permanently if duration is zero, and confirms it.
+func (l numberList) addEntry(c *commands.Context, entry, arg string, duration time.Duration, reason string) {
+	details := exclusion.Details{Reason: reason, Author: authorName(c.Event)}
+	if duration > 0 {
+		details.Expires = time.Now().Add(duration).Truncate(time.Second)
+	}
+	number, err := l.manager.Add(entry, details)
+	if err != nil {
+		c.Reply("exclude.invalid", locale.Data{"Number": arg})
+		return
+	}
+	if duration > 0 {
+		c.Reply(l.add+".added_for", locale.Data{"Number": number, "Duration": commands.FormatDuration(duration)})
+		return
+	}
+	c.Reply(l.add+".added", locale.Data{"Number": number})
+}
+
+// removeCommand removes a number from the list.
+func (l numberList) removeCommand(c *commands.Context) {
+	number := c.Args[0]
+	entry, err := exclusionEntry(l.manager, number)
+	if err != nil {
+		c.Reply(l.remove+".not_found", locale.Data{"Number": number})
+		return
+	}
+	removed := l.manager.Remove(entry)
+	if !removed && entry != number && strings.HasSuffix(number, "@"+types.HiddenUserServer) {
+		// The LID may have been added before its phone number was known
+		removed = l.manager.Remove(number)
+	}
+	if !removed {
+		c.Reply(l.remove+".not_found", locale.Data{"Number": number})
+		return
+	}
+	c.Reply(l.remove+".removed", locale.Data{"Number": number})
+}
+
+// muteCommand adds the contact of the chat it is sent in to the list for a while, MUTE_DURATION by default.
+func (l numberList) muteCommand(c *commands.Context) {
+	duration := muteDuration
+	if len(c.Args) == 1 {
+		var err error
+		if duration, err = commands.ParseDuration(c.Args[0]); err != nil {
+			c.Reply("exclude.invalid_duration", locale.Data{"Duration": c.Args[0]})
+			return
+		}
+	}
+
+	chat := c.Event.Info.Chat.ToNonAD()
+	entry := chat.String()
+	if chat.Server == types.DefaultUserServer || chat.Server == types.HiddenUserServer {
+		// Store direct chats by phone number when known, like exclusionEntry does for LIDs
+		if id := identityResolver.Resolve(context.Background(), chat, types.EmptyJID); !id.PN.IsEmpty() {
+			entry = id.PN.User
+		}
+	}
+	l.addEntry(c, entry, entry, duration, "")
+}
+
+// grantCommand adds extra transcription time to the quota of a contact or group, used once their
+// daily or monthly limit is reached.
+func grantCommand(c *commands.Context) {
+	duration, err := commands.ParseDuration(c.Args[1])
+	if err != nil || duration < time.Second {
+		c.Reply("exclude.invalid_duration", locale.Data{"Duration": c.Args[1]})
+		return
+	}
+	number, keys, err := quotaSubject(c.Args[0])
+	if err != nil {
+		c.Reply("exclude.invalid", locale.Data{"Number": c.Args[0]})
+		return
+	}
+	extra := quotaStore.Grant(int(duration.Seconds()), keys...)
+	c.Reply("grant.done", locale.Data{
+		"Number":   number,
+		"Duration": commands.FormatDuration(duration),
+		"Extra":    commands.FormatDuration(time.Duration(extra) * time.Second),
+	})
+}
+
+// quotaSubject converts a command argument to the keys its quota usage may be stored under, and the
+// form it is shown in. Arguments may be phone numbers, LIDs or group JIDs.
+func quotaSubject(arg string) (string, []string, error) {
+	if !strings.Contains(arg, "@") {
+		number, err := phone.Normalize(arg, defaultCountryCode)
+		if err != nil {
+			return "", nil, err
+		}
+		return number, phone.Variants(number), nil
+	}
+	jid, err := types.ParseJID(arg)
+	if err != nil {
+		return "", nil, err
+	}
+	if jid.Server == types.HiddenUserServer {
+		id := identityResolver.Resolve(context.Background(), jid, types.EmptyJID)
+		if !id.PN.IsEmpty() {
+			return id.PN.User, quotaKeys(id), nil
+		}
+		return jid.String(), quotaKeys(id), nil
+	}
+	return jid.String(), []string{jid.String()}, nil
+}
+
+// authorName identifies the sender of a command in list entries, by phone number when known.
+func authorName(v *events.Message) string {
+	if id := resolveSender(v); !id.PN.IsEmpty() {
+		return id.PN.User
+	}
+	return v.Info.Sender.ToNonAD().String()
+}
+
+// exclusionEntry converts a command argument to a number list entry. Typed phone numbers are
+// normalized, and LIDs are stored as the phone number they map to when known, so exclusions match
+// both forms.
+func exclusionEntry(manager *exclusion.Manager, arg string) (string, error) {
+	if !strings.HasSuffix(arg, "@"+types.HiddenUserServer) {
+		return manager.Normalize(arg)
+	}
+	jid, err := types.ParseJID(arg)
+	if err != nil {
+		return "", err
+	}
+	if id := identityResolver.Resolve(context.Background(), jid, types.EmptyJID); !id.PN.IsEmpty() {
+		return id.PN.User, nil
+	}
+	return jid.String(), nil
+}
+
+// stopCommand excludes the sender from transcription at their own request. Every opt-out is recorded
+// in the opt-out audit log. A permanent exclusion made by an admin is kept as is, so /start can't undo
+// it, while a temporary one is replaced by the opt-out, so it doesn't end when the admin's expires.
+func stopCommand(c *commands.Context) {
+	self := authorName(c.Event)
+	optOutLog.Record(audit.Event{Action: "stop", Subject: self, Chat: c.Event.Info.Chat.String()})
+	if entry, ok := exclusionManager.Get(self); ok && !entry.Self && entry.Expires.IsZero() {
+		c.Reply("stop.done", nil)
+		return
+	}
+	if _, err := exclusionManager.Add(self, exclusion.Details{Reason: "Opted out with /stop", Author: self, Self: true}); err != nil {
+		log.Error("Failed to opt out", zap.String("jid", self), zap.Error(err))
+		c.Reply("stop.failed", nil)
+		return
+	}
+	c.Reply("stop.done", nil)
+}
+
+// startCommand includes the sender again after they opted out with /stop. Exclusions made by admins
+// can only be lifted by an admin.
+func startCommand(c *commands.Context) {
+	self := authorName(c.Event)
+	entry, ok := exclusionManager.Get(self)
+	if !ok {
+		c.Reply("start.not_stopped", nil)
+		return
+	}
+	if !entry.Self {
+		c.Reply("start.excluded_by_admin", nil)
+		return
+	}
+	exclusionManager.Remove(self)
+	optOutLog.Record(audit.Event{Action: "start", Subject: self, Chat: c.Event.Info.Chat.String()})
+	c.Reply("start.done", nil)
+}
+
+// retranscribeCommand transcribes the quoted audio again, even if it was already processed.
+func retranscribeCommand(c *commands.Context) {
+	quoted, ok := quotedAudio(c.Event)
+	if !ok {
+		c.Reply("retranscribe.no_audio", nil)
+		return
+	}
+	if !hasConsent(quoted) {
+		c.Reply("transcribe.no_consent", nil)
+		return
+	}
+	job := newJob(quoted)
+	job.Quota = newMessageQuota(c.Event)
+	processedStore.Forget(messageKey(quoted))
+	processedStore.Begin(messageKey(quoted))
+	startJob(job, authorName(c.Event))
+}
+
+// transcribeCommand transcribes the quoted audio on demand, optionally in the given language, even
+// in chats where audio is not transcribed automatically.
+func transcribeCommand(c *commands.Context) {
+	quoted, ok := quotedAudio(c.Event)
+	if !ok {
+		c.Reply("retranscribe.no_audio", nil)
+		return
+	}
+	// The same rules as for automatic transcription apply, apart from the chat being turned on
+	if isExcludedMessage(quoted) {
+		c.Reply("transcribe.excluded", nil)
+		return
+	}
+	if !isAllowed(quoted) {
+		c.Reply("transcribe.not_allowed", nil)
+		return
+	}
+	if !hasConsent(quoted) {
+		c.Reply("transcribe.no_consent", nil)
+		return
+	}
+	job := newJob(quoted)
+	if len(c.Args) == 1 {
+		language := strings.ToLower(c.Args[0])
+		if !languagePattern.MatchString(language) {
+			c.Reply("command.usage", locale.Data{"Usage": c.Sink.Text(c.Name+".usage", nil)})
+			return
+		}
+		job.Language = language
+	}
+	// Charge the transcription to whoever asked for it, not the audio's sender
+	job.Quota = newMessageQuota(c.Event)
+	processedStore.Forget(messageKey(quoted))
+	processedStore.Begin(messageKey(quoted))
+	startJob(job, authorName(c.Event))
+}
+
+// languagePattern matches the ISO 639 language codes accepted by /transcribe.
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// quotedAudio returns the audio message a command replies to. The media cache is preferred, since the
+// quoted copy of a message may be incomplete.
+func quotedAudio(v *events.Message) (*events.Message, bool) {
+	contextInfo := v.Message.GetExtendedTextMessage().GetContextInfo()
+	if id := contextInfo.GetStanzaID(); id != "" {
+		if audio, ok := mediaCache.Lookup(v.Info.Chat, id); ok {
+			return audio, true
+		}
+	}
+	return transcription.QuotedAudioEvent(v)
+}
+
+// cancelCommand cancels the quoted audio's job, or the most recent one in the chat. Only admins may
+// cancel the transcription of someone else's audio.
+func cancelCommand(c *commands.Context) {
+	owner := authorName(c.Event)
+	if c.Level >= commands.LevelGroupAdmin || (c.Event.Info.IsGroup && canManageChat(c)) {
+		owner = ""
+	}
+	chat := c.Event.Info.Chat
+	key := ""
+	if id := c.Event.Message.GetExtendedTextMessage().GetContextInfo().GetStanzaID(); id != "" {
+		key = jobKey(chat, id)
+	} else {
+		key, _ = lifecycleManager.Latest(chat.ToNonAD().String(), owner)
+	}
+	if key != "" && lifecycleManager.Cancel(key, owner) {
+		c.Reply("cancel.done", nil)
+	} else {
+		c.Reply("cancel.none", nil)
+	}
+}
+
+// feedbackCommand turns progress reactions or the typing indicator on or off for the chat.
+func feedbackCommand(c *commands.Context) {
+	state := strings.ToLower(c.Args[0])
+	if state != "on" && state != "off" {
+		c.Reply("command.usage", locale.Data{"Usage": c.Sink.Text(c.Name+".usage", nil)})
+		return
+	}
+	enabled := state == "on"
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		if c.Name == "reactions" {
+			s.Reactions = &enabled
+		} else {
+			s.Presence = &enabled
+		}
+	})
+	c.Reply(c.Name+".updated", locale.Data{"Enabled": enabled})
+}
+
+// localeCommand sets the language of bot messages in the chat.
+func localeCommand(c *commands.Context) {
+	if !catalog.Has(c.Args[0]) {
+		c.Reply("locale.unknown", locale.Data{"Locales": strings.Join(catalog.Locales(), ", ")})
+		return
+	}
+	chosen := catalog.Resolve(c.Args[0])
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		s.Locale = chosen
+	})
+	c.Reply("locale.updated", locale.Data{"Locale": chosen})
+}
+
+// styleCommand sets the formatting of transcripts in the chat.
+func styleCommand(c *commands.Context) {
+	value := strings.ToLower(c.Args[0])
+	if value != "default" {
+		style, ok := transcription.ParseStyle(value)
+		if !ok {
+			c.Reply("command.usage", locale.Data{"Usage": c.Sink.Text(c.Name+".usage", nil)})
+			return
+		}
+		value = string(style)
+	}
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		s.Style = clearDefault(value)
+	})
+	c.Reply("settings.updated", settingsData(c))
+}
+
+// languageCommand sets the language of audio in the chat, "auto" to detect it.
+func languageCommand(c *commands.Context) {
+	value := strings.ToLower(c.Args[0])
+	if value != "auto" && value != "default" && !languagePattern.MatchString(value) {
+		c.Reply("command.usage", locale.Data{"Usage": c.Sink.Text(c.Name+".usage", nil)})
+		return
+	}
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		s.Language = clearDefault(value)
+	})
+	c.Reply("settings.updated", settingsData(c))
+}
+
+// translateCommand sets the language transcripts in the chat are translated into. Providers only
+// translate into English.
+func translateCommand(c *commands.Context) {
+	value := strings.ToLower(c.Args[0])
+	if value != "en" && value != "off" && value != "default" {
+		c.Reply("translate.unsupported", locale.Data{"Language": value})
+		return
+	}
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		s.Translate = clearDefault(value)
+	})
+	c.Reply("settings.updated", settingsData(c))
+}
+
+// providerCommand sets the transcription provider of the chat.
+func providerCommand(c *commands.Context) {
+	value := strings.ToLower(c.Args[0])
+	if _, ok := providers[value]; !ok && value != "default" {
+		var names []string
+		for name := range providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		c.Reply("provider.unknown", locale.Data{"Providers": strings.Join(names, ", ")})
+		return
+	}
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		s.Provider = clearDefault(value)
+	})
+	c.Reply("settings.updated", settingsData(c))
+}
+
+// maxDurationCommand sets the longest audio transcribed in the chat, "off" for no limit.
+func maxDurationCommand(c *commands.Context) {
+	value := strings.ToLower(c.Args[0])
+	seconds := 0
+	switch value {
+	case "default":
+	case "off":
+		seconds = -1
+	default:
+		duration, err := commands.ParseDuration(value)
+		if err != nil || duration < time.Second {
+			c.Reply("exclude.invalid_duration", locale.Data{"Duration": c.Args[0]})
+			return
+		}
+		seconds = int(duration.Seconds())
+	}
+	// The limit caps costs, so only admins may raise it or turn it off
+	if c.Level < commands.LevelAdmin && !tighterLimit(seconds, getChatSettings(c.Event.Info.Chat)) {
+		c.Reply("command.not_authorized", nil)
+		return
+	}
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		s.MaxDuration = seconds
+	})
+	c.Reply("settings.updated", settingsData(c))
+}
+
+// settingsCommand shows the effective settings of the chat, or with "reset" clears the chat's own
+// settings, apart from whether transcription is on.
+func settingsCommand(c *commands.Context) {
+	if len(c.Args) == 1 {
+		if strings.ToLower(c.Args[0]) != "reset" {
+			c.Reply("command.usage", locale.Data{"Usage": c.Sink.Text(c.Name+".usage", nil)})
+			return
+		}
+		if !canManageChat(c) {
+			c.Reply("command.not_authorized", nil)
+			return
+		}
+		updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+			reset := settings.Settings{Enabled: s.Enabled}
+			if c.Level < commands.LevelAdmin {
+				// Only admins may loosen the cost controls
+				reset.Provider, reset.MaxDuration = s.Provider, s.MaxDuration
+			}
+			*s = reset
+		})
+	}
+	c.Reply("settings.show", settingsData(c))
+}
+
+// settingsData describes the effective settings of the command's chat for message templates.
+func settingsData(c *commands.Context) locale.Data {
+	custom := getChatSettings(c.Event.Info.Chat) != (settings.Settings{})
+	if c.Event.Info.IsGroup && getChatSettings(c.Event.Info.Sender) != (settings.Settings{}) {
+		custom = true
+	}
+	job := newJob(c.Event)
+	language := job.Language
+	if language == "" {
+		language = "auto"
+	}
+	translate := job.Translate
+	if translate == "" {
+		translate = "off"
+	}
+	maxDuration := "off"
+	if job.MaxSeconds > 0 {
+		maxDuration = commands.FormatDuration(time.Duration(job.MaxSeconds) * time.Second)
+	}
+	return locale.Data{
+		"Language":    language,
+		"Translate":   translate,
+		"Style":       string(job.Style),
+		"Provider":    job.Provider,
+		"MaxDuration": maxDuration,
+		"Enabled":     chatEnabled(c.Event.Info.Chat),
+		"Reactions":   job.Reactions,
+		"Presence":    job.Presence,
+		"Locale":      chatLocale(c.Event.Info.Chat),
+		"Custom":      custom,
+	}
+}
+
+// tighterLimit reports whether a chat's MaxDuration setting of seconds, as stored by /maxduration,
+// would not raise the audio duration limit that applies with the chat's current settings.
+func tighterLimit(seconds int, current settings.Settings) bool {
+	limit := maxSeconds(settings.Settings{MaxDuration: seconds})
+	currentLimit := maxSeconds(current)
+	return currentLimit == 0 || (limit > 0 && limit <= currentLimit)
+}
+
+// clearDefault maps the "default" argument of settings commands to an unset setting.
+func clearDefault(value string) string {
+	if value == "default" {
+		return ""
+	}
+	return value
+}
+
+// enableCommand turns transcription on or off in the chat. Groups start out disabled.
+func enableCommand(c *commands.Context) {
+	enabled := c.Name == "on"
+	updateChatSettings(c.Event.Info.Chat, func(s *settings.Settings) {
+		s.Enabled = &enabled
+	})
+	c.Reply(c.Name+".updated", nil)
+}
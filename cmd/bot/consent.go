@@ -0,0 +1,80 @@
+package main
+
+import (
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/consent"
+	"whatsapp-transcriber-go/internal/locale"
+)
+
+// checkConsent sends the one-time consent notice before a contact's first audio is transcribed. In wait
+// mode, audio is held until the contact replies, and any other message from a notified contact counts
+// as consent and releases their held audio. It reports whether the message should be processed further.
+func checkConsent(v *events.Message) bool {
+	if consentMode == "off" || v.Info.IsFromMe {
+		return true
+	}
+
+	key, record, found := consentStore.Find(resolveSender(v).Keys()...)
+	if v.Message.GetAudioMessage() == nil {
+		if consentMode == "wait" && found && record.Consented.IsZero() {
+			if held, ok := consentStore.Consent(key); ok {
+				releaseHeld(held)
+			}
+		}
+		return true
+	}
+
+	if !found || (consentMode == "wait" && record.Consented.IsZero()) {
+		if !found {
+			key = authorName(v)
+		}
+		if consentStore.Notify(key, consentMode) {
+			noticeKey := "consent.notice"
+			if consentMode == "wait" {
+				noticeKey = "consent.notice_wait"
+			}
+			reply(v, noticeKey, locale.Data{"Provider": chosenProvider(effectiveSettings(v)).name})
+		}
+	}
+	if consentMode == "notice" || !record.Consented.IsZero() {
+		return true
+	}
+
+	log.Info("Holding audio until the sender consents", zap.String("id", v.Info.ID), zap.String("from", key))
+	consentStore.Hold(key, consent.Held{Chat: v.Info.Chat.String(), ID: v.Info.ID})
+	return false
+}
+
+// hasConsent reports whether a message's audio may be transcribed on demand. In wait mode, audio
+// from contacts who haven't consented is held, and must not be transcribed with a command either.
+func hasConsent(v *events.Message) bool {
+	if consentMode != "wait" || v.Info.IsFromMe {
+		return true
+	}
+	_, record, found := consentStore.Find(resolveSender(v).Keys()...)
+	return found && !record.Consented.IsZero()
+}
+
+// releaseHeld starts the transcription of audio held until its sender consented.
+func releaseHeld(held []consent.Held) {
+	for _, h := range held {
+		chat, err := types.ParseJID(h.Chat)
+		if err != nil {
+			log.Error("Invalid chat of held audio", zap.String("chat", h.Chat), zap.Error(err))
+			continue
+		}
+		audio, ok := mediaCache.Lookup(chat, h.ID)
+		if !ok {
+			log.Warn("Held audio no longer available", zap.String("chat", h.Chat), zap.String("id", h.ID))
+			continue
+		}
+		if !processedStore.Begin(messageKey(audio)) {
+			continue
+		}
+		log.Info("Releasing held audio", zap.String("id", h.ID))
+		startJob(newJob(audio), authorName(audio))
+	}
+}
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/skip2/go-qrcode"
@@ -14,20 +19,72 @@ import (
 	"go.mau.fi/whatsmeow/binary/proto"
 	_ "github.com/mattn/go-sqlite3"
 	"go.mau.fi/whatsmeow/store/sqlstore"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 //	"image/color" // Added for QR code terminal display
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"whatsapp-transcriber-go/internal/audit"
+	"whatsapp-transcriber-go/internal/auth"
+	"whatsapp-transcriber-go/internal/commands"
+	"whatsapp-transcriber-go/internal/consent"
 	"whatsapp-transcriber-go/internal/exclusion"
+	"whatsapp-transcriber-go/internal/identity"
+	"whatsapp-transcriber-go/internal/lifecycle"
+	"whatsapp-transcriber-go/internal/locale"
+	"whatsapp-transcriber-go/internal/media"
+	"whatsapp-transcriber-go/internal/phone"
+	"whatsapp-transcriber-go/internal/processed"
+	"whatsapp-transcriber-go/internal/quota"
+	"whatsapp-transcriber-go/internal/scheduler"
+	"whatsapp-transcriber-go/internal/settings"
 	"whatsapp-transcriber-go/internal/transcription"
 )
 
 var log *zap.Logger
 var cli *whatsmeow.Client
 var exclusionManager *exclusion.Manager
-var transcriberService transcription.Transcriber
+var providers map[string]provider
+var defaultProvider string
+var translateTo string
+var maxAudioSeconds int
 var transcriptionLanguage string
+var lifecycleManager *lifecycle.Manager
+var shutdownTimeout time.Duration
+var resumeOnce sync.Once
+var jobScheduler *scheduler.Scheduler
+var vipNumbers map[string]bool
+var processedStore *processed.Store
+var backlogPolicy string
+var backlogMaxAge time.Duration
+var offlineDigest *transcription.Digest
+var jobTimeoutBase time.Duration
+var jobTimeoutFactor float64
+var settingsStore *settings.Store
+var defaultReactions bool
+var defaultPresence bool
+var replyMaxLength int
+var documentThreshold int
+var documentFormat string
+var chunkSeconds int
+var transcriptStyle transcription.Style
+var catalog *locale.Catalog
+var defaultLocale string
+var commandRouter *commands.Router
+var authorizer *auth.Authorizer
+var defaultCountryCode string
+var identityResolver *identity.Resolver
+var muteDuration time.Duration
+var accessMode string
+var mediaCache *media.Cache
+var optOutLog *audit.Log
+var consentMode string
+var consentStore *consent.Store
+var allowlistManager *exclusion.Manager
+var quotaStore *quota.Store
+var senderLimits quota.Limits
+var chatLimits quota.Limits
 
 func main() {
 	// Load .env file
@@ -69,9 +126,125 @@ func main() {
 	}
 	cli = whatsmeow.NewClient(deviceStore, nil)
 	cli.AddEventHandler(eventHandler)
+	identityResolver = identity.NewResolver(cli.Store.LIDs, log)
+
+	defaultCountryCode = os.Getenv("DEFAULT_COUNTRY_CODE")
+	if defaultCountryCode == "" {
+		defaultCountryCode = "55" // Default to Brazil
+	}
+
+	// Configure who may manage the bot. The owner is known once logged in.
+	authorizer = auth.NewAuthorizer(envNumbers("ADMIN_NUMBERS"), envBool("ADMIN_SELF_CHAT_ONLY", false))
+	if cli.Store.ID != nil {
+		authorizer.SetOwner(*cli.Store.ID, cli.Store.GetLID())
+	}
 
 	// Initialize exclusion manager
-	exclusionManager = exclusion.NewManager("data/exclude.txt", log)
+	exclusionManager = exclusion.NewManager("data/exclude.jsonl", defaultCountryCode, log)
+	if _, err := exclusionManager.ImportLegacy("data/exclude.txt"); err != nil {
+		log.Error("Failed to import legacy exclusion list", zap.Error(err))
+	}
+	muteDuration = envDuration("MUTE_DURATION", 8*time.Hour)
+	optOutLog = audit.NewLog("data/optout.jsonl", log)
+
+	// In allow mode, only contacts and chats on the allowlist are transcribed
+	accessMode = os.Getenv("ACCESS_MODE")
+	switch accessMode {
+	case "":
+		accessMode = "deny"
+	case "deny", "allow":
+	default:
+		log.Fatal("Invalid ACCESS_MODE, expected deny or allow", zap.String("value", accessMode))
+	}
+	allowlistManager = exclusion.NewManager("data/allow.jsonl", defaultCountryCode, log)
+	if _, err := allowlistManager.ImportLegacy("data/allow.txt"); err != nil {
+		log.Error("Failed to import legacy allowlist", zap.Error(err))
+	}
+	log.Info("Access mode configured", zap.String("mode", accessMode), zap.Int("allowed", allowlistManager.Count()))
+
+	// Register chat commands
+	commandRouter = commands.NewRouter(log)
+	registerCommands(commandRouter)
+
+	// Configure the first-contact consent notice
+	consentMode = os.Getenv("CONSENT_MODE")
+	switch consentMode {
+	case "":
+		consentMode = "notice"
+	case "off", "notice", "wait":
+	default:
+		log.Fatal("Invalid CONSENT_MODE, expected off, notice or wait", zap.String("value", consentMode))
+	}
+	consentStore = consent.NewStore("data/consent.json", log)
+
+	// Configure quotas of transcribed audio per sender and per group
+	quotaStore = quota.NewStore("data/quota.json", log)
+	senderLimits = quota.Limits{
+		Daily:   int(envDuration("QUOTA_SENDER_DAILY", 0).Seconds()),
+		Monthly: int(envDuration("QUOTA_SENDER_MONTHLY", 0).Seconds()),
+	}
+	chatLimits = quota.Limits{
+		Daily:   int(envDuration("QUOTA_CHAT_DAILY", 0).Seconds()),
+		Monthly: int(envDuration("QUOTA_CHAT_MONTHLY", 0).Seconds()),
+	}
+
+	// Initialize recent audio cache for on-demand transcription
+	mediaCache = media.NewCache("data/media.jsonl", log)
+
+	// Initialize processed message store
+	processedStore = processed.NewStore("data/processed.jsonl", log)
+
+	// Configure handling of audio received while the bot was offline
+	backlogPolicy = os.Getenv("BACKLOG_POLICY")
+	switch backlogPolicy {
+	case "":
+		backlogPolicy = "late" // Default to transcribing with a late annotation
+	case "normal", "ignore", "digest", "late":
+	default:
+		log.Fatal("Invalid BACKLOG_POLICY, expected normal, ignore, digest or late", zap.String("value", backlogPolicy))
+	}
+	backlogMaxAge = envDuration("BACKLOG_MAX_AGE", 10*time.Minute)
+
+	// Configure delivery of long transcripts
+	replyMaxLength = envInt("REPLY_MAX_LENGTH", 4000)
+	documentThreshold = envInt("DOCUMENT_THRESHOLD", 20000)
+	documentFormat = os.Getenv("DOCUMENT_FORMAT")
+	if documentFormat != "md" {
+		documentFormat = "txt"
+	}
+
+	chunkSeconds = envInt("CHUNK_SECONDS", 0)
+	transcriptStyle = transcription.StyleItalic
+	if value := os.Getenv("TRANSCRIPT_STYLE"); value != "" {
+		style, ok := transcription.ParseStyle(value)
+		if !ok {
+			log.Fatal("Invalid TRANSCRIPT_STYLE, expected italic, plain, quote or monospace", zap.String("value", value))
+		}
+		transcriptStyle = style
+	}
+
+	// Initialize per-chat settings
+	settingsStore = settings.NewStore("data/settings.json", log)
+	defaultReactions = envBool("FEEDBACK_REACTIONS", true)
+	defaultPresence = envBool("FEEDBACK_PRESENCE", false)
+
+	// Initialize job lifecycle manager
+	lifecycleManager = lifecycle.NewManager("data/pending.json", log)
+	shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	jobTimeoutBase = envDuration("JOB_TIMEOUT_BASE", 60*time.Second)
+	jobTimeoutFactor = envFloat("JOB_TIMEOUT_FACTOR", 3)
+
+	// Pick up hand edits of the exclusion list and allowlist until shutdown
+	listReloadInterval := envDuration("LIST_RELOAD_INTERVAL", 5*time.Second)
+	exclusionManager.Watch(lifecycleManager.Context(), listReloadInterval)
+	allowlistManager.Watch(lifecycleManager.Context(), listReloadInterval)
+
+	// Initialize job scheduler
+	jobScheduler = scheduler.NewScheduler(envInt("MAX_CONCURRENT_JOBS", 4), envFloat("JOB_AGING_RATE", 10), log)
+	vipNumbers = make(map[string]bool)
+	for _, number := range envNumbers("VIP_NUMBERS") {
+		vipNumbers[number] = true
+	}
 
 	// Configure transcription service
 	groqAPIKey := os.Getenv("GROQ_API_KEY")
@@ -82,15 +255,41 @@ func main() {
 		transcriptionLanguage = "pt" // Default to Portuguese
 	}
 
+	// Every configured provider can be chosen per chat with /provider. Groq is the default if configured.
+	providers = make(map[string]provider)
+	if cloudflareAccountID != "" && cloudflareAPIKey != "" {
+		providers["cloudflare"] = provider{
+			name:        "Cloudflare AI",
+			transcriber: transcription.NewCloudflareAITranscriber(cloudflareAccountID, cloudflareAPIKey, "@cf/openai/whisper", log),
+		}
+		defaultProvider = "cloudflare"
+	}
 	if groqAPIKey != "" {
-		transcriberService = transcription.NewGroqTranscriber(groqAPIKey, "whisper-large-v3", log)
-		log.Info("Using Groq API for transcription.")
-	} else if cloudflareAccountID != "" && cloudflareAPIKey != "" {
-		transcriberService = transcription.NewCloudflareAITranscriber(cloudflareAccountID, cloudflareAPIKey, "@cf/openai/whisper", log)
-		log.Info("Using Cloudflare AI for transcription.")
-	} else {
+		providers["groq"] = provider{
+			name:        "Groq",
+			transcriber: transcription.NewGroqTranscriber(groqAPIKey, "whisper-large-v3", log),
+		}
+		defaultProvider = "groq"
+	}
+	if defaultProvider == "" {
 		log.Fatal("No transcription API keys found. Please set GROQ_API_KEY or CF_ACCOUNT_ID and CF_API_KEY in your .env file.")
 	}
+	log.Info("Using " + providers[defaultProvider].name + " for transcription.")
+
+	// Defaults of the settings that chats and contacts can override
+	translateTo = os.Getenv("TRANSLATE_TO")
+	maxAudioSeconds = int(envDuration("MAX_AUDIO_DURATION", 0).Seconds())
+
+	// Load message catalogs, defaulting to the transcription language when a catalog exists for it
+	catalog = locale.NewCatalog("data/templates", "en", log)
+	defaultLocale = os.Getenv("BOT_LOCALE")
+	if defaultLocale == "" && catalog.Has(transcriptionLanguage) {
+		defaultLocale = transcriptionLanguage
+	}
+	defaultLocale = catalog.Resolve(defaultLocale)
+	offlineDigest = transcription.NewDigest(cli, catalog, chatLocale, log)
+	offlineDigest.Style = transcriptStyle
+	offlineDigest.MaxLength = replyMaxLength
 
 	// Load session or login
 	if cli.Store.ID == nil {
@@ -145,8 +344,368 @@ func main() {
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 
+	log.Info("Shutting down...")
+	lifecycleManager.Shutdown(shutdownTimeout)
 	cli.Disconnect()
 	log.Info("Disconnected from WhatsApp.")
+	log.Sync()
+}
+
+// envDuration reads a Go duration from the environment, falling back to def if unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Warn("Invalid duration in environment, using default", zap.String("key", key), zap.String("value", value), zap.Error(err))
+		return def
+	}
+	return parsed
+}
+
+// envInt reads an integer from the environment, falling back to def if unset or invalid.
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Warn("Invalid integer in environment, using default", zap.String("key", key), zap.String("value", value), zap.Error(err))
+		return def
+	}
+	return parsed
+}
+
+// envFloat reads a number from the environment, falling back to def if unset or invalid.
+func envFloat(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Warn("Invalid number in environment, using default", zap.String("key", key), zap.String("value", value), zap.Error(err))
+		return def
+	}
+	return parsed
+}
+
+// envBool reads a boolean from the environment, falling back to def if unset or invalid.
+func envBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warn("Invalid boolean in environment, using default", zap.String("key", key), zap.String("value", value), zap.Error(err))
+		return def
+	}
+	return parsed
+}
+
+// envList reads a comma-separated list from the environment, skipping empty items.
+func envList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// newJob creates a transcription job for the message with its effective settings.
+func newJob(v *events.Message) *transcription.Job {
+	effective := effectiveSettings(v)
+	chosen := chosenProvider(effective)
+	job := transcription.NewJob(cli, v, log, chosen.transcriber, effectiveLanguage(effective))
+	job.Timeout = jobTimeoutBase + time.Duration(jobTimeoutFactor*float64(job.EstimatedSeconds()))*time.Second
+	job.Reactions = settings.Bool(effective.Reactions, defaultReactions)
+	job.Presence = settings.Bool(effective.Presence, defaultPresence)
+	job.Catalog = catalog
+	job.Locale = chatLocale(v.Info.Chat)
+	job.Provider = chosen.name
+	job.MaxLength = replyMaxLength
+	job.DocumentThreshold = documentThreshold
+	job.DocumentFormat = documentFormat
+	job.ChunkSeconds = chunkSeconds
+	job.Style = transcriptStyle
+	if style, ok := transcription.ParseStyle(effective.Style); ok {
+		job.Style = style
+	}
+	job.Translate = translateTo
+	if effective.Translate != "" {
+		job.Translate = effective.Translate
+	}
+	if job.Translate == "off" {
+		job.Translate = ""
+	}
+	job.MaxSeconds = maxSeconds(effective)
+	job.Quota = newMessageQuota(v)
+	return job
+}
+
+// provider is a configured transcription service.
+type provider struct {
+	name        string // Display name, available to message templates
+	transcriber transcription.Transcriber
+}
+
+// chosenProvider returns the provider selected by settings, or the default one.
+func chosenProvider(s settings.Settings) provider {
+	if p, ok := providers[s.Provider]; ok {
+		return p
+	}
+	return providers[defaultProvider]
+}
+
+// effectiveSettings resolves the settings of a message: the global defaults, overridden by the chat's
+// settings, overridden in turn by the sender's own settings, i.e. those of their direct chat. The
+// sender's settings can't loosen a group's cost controls: the group's provider is kept, and the
+// sender's duration limit only applies if it is stricter than the group's.
+func effectiveSettings(v *events.Message) settings.Settings {
+	effective := getChatSettings(v.Info.Chat)
+	if v.Info.IsGroup {
+		chat, sender := effective, getChatSettings(v.Info.Sender)
+		effective = chat.Merge(sender)
+		effective.Provider = chat.Provider
+		limit := maxSeconds(chat)
+		if sender.MaxDuration > 0 && (limit == 0 || sender.MaxDuration < limit) {
+			limit = sender.MaxDuration
+		}
+		effective.MaxDuration = limit
+		if limit == 0 {
+			effective.MaxDuration = -1
+		}
+	}
+	return effective
+}
+
+// maxSeconds returns the audio duration limit of settings in seconds, zero for no limit.
+func maxSeconds(s settings.Settings) int {
+	switch {
+	case s.MaxDuration > 0:
+		return s.MaxDuration
+	case s.MaxDuration < 0:
+		return 0
+	}
+	return maxAudioSeconds
+}
+
+// effectiveLanguage returns the audio language to request from the provider, empty to detect it.
+func effectiveLanguage(s settings.Settings) string {
+	switch s.Language {
+	case "":
+		return transcriptionLanguage
+	case "auto":
+		return ""
+	}
+	return s.Language
+}
+
+// envNumbers reads a comma-separated list of phone numbers from the environment, normalized to
+// E.164 digits together with their equivalent forms. Invalid numbers are skipped.
+func envNumbers(key string) []string {
+	var numbers []string
+	for _, item := range envList(key) {
+		number, err := phone.Normalize(item, defaultCountryCode)
+		if err != nil {
+			log.Warn("Invalid phone number in environment, skipping", zap.String("key", key), zap.String("value", item), zap.Error(err))
+			continue
+		}
+		numbers = append(numbers, phone.Variants(number)...)
+	}
+	return numbers
+}
+
+// startJob submits a transcription job to the lifecycle manager. The owner is who may cancel it
+// besides admins: the audio's sender, or whoever asked for an on-demand transcription.
+func startJob(job *transcription.Job, owner string) {
+	v := job.Message
+	key := messageKey(v)
+	var payload interface{}
+	if pending, err := job.Pending(); err != nil {
+		log.Error("Failed to build pending job record", zap.Error(err))
+	} else {
+		payload = pending
+	}
+	sender := resolveSender(v)
+	priority := scheduler.Priority{
+		Seconds: job.EstimatedSeconds(),
+		VIP:     vipNumbers[sender.PN.User] || authorizer.IsAdmin(sender.Phone()),
+	}
+	run := func(ctx context.Context) error {
+		release, err := jobScheduler.Acquire(ctx, priority)
+		if err != nil {
+			// HandleAudioMessage never runs, so the digest must not keep waiting for this job
+			if job.Digest != nil {
+				job.Digest.Done(v.Info.Chat)
+			}
+			return err
+		}
+		defer release()
+
+		err = job.HandleAudioMessage(ctx)
+		switch {
+		case err == nil:
+			processedStore.Finish(key, processed.OutcomeDone)
+		case errors.Is(err, context.Canceled) && lifecycleManager.Context().Err() != nil:
+			// Interrupted by shutdown, the job is resumed on the next start
+		case errors.Is(err, context.Canceled):
+			processedStore.Finish(key, processed.OutcomeCancelled)
+		case errors.Is(err, transcription.ErrTooLong), errors.Is(err, transcription.ErrQuotaReached):
+			processedStore.Finish(key, processed.OutcomeIgnored)
+		default:
+			processedStore.Finish(key, processed.OutcomeFailed)
+		}
+		return err
+	}
+	if !lifecycleManager.Go(jobKey(v.Info.Chat, v.Info.ID), v.Info.Chat.ToNonAD().String(), owner, payload, run) {
+		log.Info("Job not started", zap.String("id", v.Info.ID), zap.String("from", v.Info.Sender.User))
+		processedStore.Forget(key)
+		if job.Digest != nil {
+			job.Digest.Done(v.Info.Chat)
+		}
+	}
+}
+
+// resolveSender returns both the phone number and LID identities of a message's sender.
+func resolveSender(v *events.Message) identity.Identity {
+	return identityResolver.Resolve(context.Background(), v.Info.Sender, v.Info.SenderAlt)
+}
+
+// isExcluded reports whether any of the identities of a user is in the exclusion list.
+func isExcluded(id identity.Identity) bool {
+	for _, key := range id.Keys() {
+		if exclusionManager.IsExcluded(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedMessage reports whether a message's sender or group is in the exclusion list.
+func isExcludedMessage(v *events.Message) bool {
+	return isExcluded(resolveSender(v)) || (v.Info.IsGroup && exclusionManager.IsExcluded(v.Info.Chat.ToNonAD().String()))
+}
+
+// isAllowed reports whether a message may be transcribed under the access mode. In allow mode, the
+// sender, under any of their identities, or the chat must be on the allowlist.
+func isAllowed(v *events.Message) bool {
+	if accessMode != "allow" {
+		return true
+	}
+	for _, key := range append(resolveSender(v).Keys(), v.Info.Chat.ToNonAD().String()) {
+		if allowlistManager.Contains(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// chatKeys returns the keys a chat's settings may be stored under. Direct chats can be addressed by
+// phone number or LID, so both are returned, phone number first.
+func chatKeys(chat types.JID) []string {
+	chat = chat.ToNonAD()
+	if chat.Server != types.DefaultUserServer && chat.Server != types.HiddenUserServer {
+		return []string{chat.String()}
+	}
+	id := identityResolver.Resolve(context.Background(), chat, types.EmptyJID)
+	var keys []string
+	for _, jid := range []types.JID{id.PN, id.LID} {
+		if !jid.IsEmpty() {
+			keys = append(keys, jid.String())
+		}
+	}
+	return keys
+}
+
+// getChatSettings returns the settings of a chat, stored under any of its keys.
+func getChatSettings(chat types.JID) settings.Settings {
+	for _, key := range chatKeys(chat) {
+		if chatSettings := settingsStore.Get(key); chatSettings != (settings.Settings{}) {
+			return chatSettings
+		}
+	}
+	return settings.Settings{}
+}
+
+// updateChatSettings applies fn to the settings of a chat, stored under its existing key or
+// its preferred one.
+func updateChatSettings(chat types.JID, fn func(*settings.Settings)) {
+	keys := chatKeys(chat)
+	key := keys[0]
+	for _, candidate := range keys {
+		if settingsStore.Get(candidate) != (settings.Settings{}) {
+			key = candidate
+			break
+		}
+	}
+	settingsStore.Update(key, fn)
+}
+
+// chatEnabled reports whether audio in a chat is transcribed. Direct chats are enabled unless turned
+// off, while groups must be turned on by a group admin.
+func chatEnabled(chat types.JID) bool {
+	direct := chat.Server == types.DefaultUserServer || chat.Server == types.HiddenUserServer
+	return settings.Bool(getChatSettings(chat).Enabled, direct)
+}
+
+// chatLocale returns the locale of bot-generated messages in a chat.
+func chatLocale(chat types.JID) string {
+	if chosen := getChatSettings(chat).Locale; chosen != "" {
+		return chosen
+	}
+	return defaultLocale
+}
+
+// reply sends a localized message to the chat the event came from.
+func reply(v *events.Message, key string, data locale.Data) {
+	text := catalog.Render(chatLocale(v.Info.Chat), key, data)
+	_, err := cli.SendMessage(context.Background(), v.Info.Chat, &proto.Message{
+		Conversation: &text,
+	})
+	if err != nil {
+		log.Error("Failed to send reply", zap.String("key", key), zap.String("to", v.Info.Chat.String()), zap.Error(err))
+	}
+}
+
+// isBacklog reports whether the message was received while the bot was offline, either because it is
+// older than BACKLOG_MAX_AGE or because it was delivered through a history sync.
+func isBacklog(v *events.Message) bool {
+	return v.SourceWebMsg != nil || time.Since(v.Info.Timestamp) > backlogMaxAge
+}
+
+// messageKey returns the key identifying a message in the processed message store.
+func messageKey(v *events.Message) string {
+	return processed.Key(v.Info.Chat.String(), v.Info.Sender.ToNonAD().String(), v.Info.ID)
+}
+
+// jobKey identifies the running job of an audio message. Message IDs are only unique within a chat.
+func jobKey(chat types.JID, id string) string {
+	return chat.ToNonAD().String() + "|" + id
+}
+
+// resumePendingJobs restarts jobs that were interrupted by the previous shutdown.
+func resumePendingJobs() {
+	for _, raw := range lifecycleManager.LoadPending() {
+		var pending transcription.PendingJob
+		if err := json.Unmarshal(raw, &pending); err != nil {
+			log.Error("Failed to parse pending job", zap.Error(err))
+			continue
+		}
+		v, err := pending.Event()
+		if err != nil {
+			log.Error("Failed to rebuild pending job", zap.Error(err))
+			continue
+		}
+		log.Info("Resuming unfinished job", zap.String("id", v.Info.ID), zap.String("from", v.Info.Sender.User))
+		startJob(newJob(v), authorName(v))
+	}
 }
 
 // printQRCodeToTerminal generates a QR code and prints it to the terminal as ASCII art.
@@ -198,12 +757,21 @@ func eventHandler(evt interface{}) {
 	switch v := evt.(type) {
 	case *events.Connected:
 		log.Info("WhatsApp client connected!")
+		if cli.Store.ID != nil {
+			authorizer.SetOwner(*cli.Store.ID, cli.Store.GetLID())
+		}
+		resumeOnce.Do(resumePendingJobs)
 	case *events.Disconnected:
 		log.Info("WhatsApp client disconnected!")
+	case *events.OfflineSyncPreview:
+		log.Info("Receiving events missed while offline", zap.Int("messages", v.Messages), zap.Int("total", v.Total))
+		offlineDigest.SetSyncing(true)
+	case *events.OfflineSyncCompleted:
+		log.Info("Finished receiving events missed while offline", zap.Int("count", v.Count))
+		offlineDigest.SetSyncing(false)
 	case *events.Message:
-		// Filter out group messages
-		if v.Info.IsGroup {
-			log.Debug("Ignoring group message", zap.String("from", v.Info.Chat.String()))
+		// Status updates and channels are not chats the bot can reply in
+		if v.Info.Chat.Server == types.BroadcastServer || v.Info.Chat.Server == types.NewsletterServer {
 			return
 		}
 
@@ -216,75 +784,63 @@ func eventHandler(evt interface{}) {
 
 		// log.Debug("Parsed text", zap.String("text", text))
 
-		// Handle administrative commands
-		if text != "" {
-			if text == "/exclude" {
-				log.Info("Executing /exclude command")
-				// Display currently excluded users
-				excluded := exclusionManager.GetAllExcluded()
-				if len(excluded) == 0 {
-					response := "No users are currently excluded from transcription."
-					cli.SendMessage(context.Background(), v.Info.Chat, &proto.Message{
-						Conversation: &response,
-					})
-				} else {
-					response := "Currently excluded users:\n"
-					for _, number := range excluded {
-						response += "- " + number + "\n"
-					}
-					cli.SendMessage(context.Background(), v.Info.Chat, &proto.Message{
-						Conversation: &response,
-					})
+		// Handle chat commands. In groups the bot is not enabled in, only commands turning it on are
+		// handled, so it doesn't answer commands meant for other bots.
+		enabled := chatEnabled(v.Info.Chat)
+		if name, _, ok := commands.Parse(text); ok {
+			if cmd, found := commandRouter.Find(name); found && (enabled || !v.Info.IsGroup || cmd.AnyChat) {
+				if commandRouter.Dispatch(text, v, senderLevel(v, cmd.Required(v)), chatSink{event: v}) {
+					return
 				}
-				return
-			} else if text == "/include" {
-				log.Info("Executing /include command")
-				// Show error for /include without number
-				response := "Usage: /include <number> - Remove a number from the exclusion list."
-				cli.SendMessage(context.Background(), v.Info.Chat, &proto.Message{
-					Conversation: &response,
-					})
-				return
-						} else if strings.HasPrefix(text, "/exclude") {
-				log.Info("Executing /exclude with number command")
-				numberToExclude := strings.TrimSpace(text[8:])
-				exclusionManager.Add(numberToExclude)
-				response := fmt.Sprintf("%s added to exclusion list.", numberToExclude)
-				cli.SendMessage(context.Background(), v.Info.Chat, &proto.Message{
-					Conversation: &response,
-					})
-				return
-						} else if strings.HasPrefix(text, "/include") {
-				log.Info("Executing /include with number command")
-				numberToInclude := strings.TrimSpace(text[8:])
-				if exclusionManager.IsExcluded(numberToInclude) {
-					exclusionManager.Remove(numberToInclude)
-					response := fmt.Sprintf("%s removed from exclusion list.", numberToInclude)
-					cli.SendMessage(context.Background(), v.Info.Chat, &proto.Message{
-							Conversation: &response,
-						})
-				} else {
-					response := fmt.Sprintf("%s not in exclusion list.", numberToInclude)
-					cli.SendMessage(context.Background(), v.Info.Chat, &proto.Message{
-							Conversation: &response,
-						})
-				}
-				return
 			}
 		}
 
-		senderJID := v.Info.Sender.User
-		// Check if sender is excluded
-		if exclusionManager.IsExcluded(senderJID) {
-			log.Debug("Ignoring message from excluded sender", zap.String("from", senderJID))
+		// Remember audio even where it isn't transcribed, so it can be transcribed on demand
+		mediaCache.Remember(v)
+
+		if !enabled {
+			log.Debug("Ignoring message in disabled chat", zap.String("chat", v.Info.Chat.String()))
+			return
+		}
+
+		// Check if sender or group is excluded, under either their phone number or LID
+		if isExcludedMessage(v) {
+			log.Debug("Ignoring message from excluded sender", zap.String("from", v.Info.Sender.String()))
+			return
+		}
+		if !isAllowed(v) {
+			log.Debug("Ignoring message from sender not on the allowlist", zap.String("from", v.Info.Sender.String()))
+			return
+		}
+
+		// Tell new contacts their audio is transcribed, and in wait mode hold it until they reply
+		if !checkConsent(v) {
 			return
 		}
 
 		// Check for audio messages
 		if v.Message.GetAudioMessage() != nil {
 			log.Info("Received audio message", zap.String("from", v.Info.Sender.User))
-			job := transcription.NewJob(cli, v, log, transcriberService, transcriptionLanguage)
-			go job.HandleAudioMessage(context.Background()) // Run in a goroutine to avoid blocking event handler
+			if !processedStore.Begin(messageKey(v)) {
+				record, _ := processedStore.Get(messageKey(v))
+				log.Info("Skipping already processed audio message", zap.String("id", v.Info.ID), zap.String("outcome", string(record.Outcome)))
+				return
+			}
+			job := newJob(v)
+			if isBacklog(v) {
+				switch backlogPolicy {
+				case "ignore":
+					log.Info("Ignoring audio received while offline", zap.String("id", v.Info.ID), zap.Time("timestamp", v.Info.Timestamp))
+					processedStore.Finish(messageKey(v), processed.OutcomeIgnored)
+					return
+				case "digest":
+					job.Digest = offlineDigest
+					offlineDigest.Expect(v.Info.Chat)
+				case "late":
+					job.Late = true
+				}
+			}
+			startJob(job, authorName(v)) // Runs in a goroutine to avoid blocking event handler
 		} else {
 			log.Debug("Received non-audio message", zap.String("from", v.Info.Sender.User), zap.String("type", v.Info.Type))
 		}
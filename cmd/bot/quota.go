@@ -0,0 +1,94 @@
+package main
+
+import (
+	"time"
+
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-transcriber-go/internal/commands"
+	"whatsapp-transcriber-go/internal/identity"
+	"whatsapp-transcriber-go/internal/locale"
+	"whatsapp-transcriber-go/internal/phone"
+	"whatsapp-transcriber-go/internal/quota"
+	"whatsapp-transcriber-go/internal/transcription"
+)
+
+// messageQuota applies the quota of a message's sender and, in groups, the group's quota to a
+// transcription job.
+type messageQuota struct {
+	sender []string // Keys of the sender's usage
+	chat   []string // Keys of the group's usage, empty in direct chats
+
+	reserved []quota.Reservation
+}
+
+// newMessageQuota returns the quota charged for a message's sender and chat, or nil if no limits are
+// configured, the sender is an admin, whose audio is never limited, or the sender has no phone number
+// or LID to count their usage under. On-demand transcriptions are
+// charged to whoever asked for them, so it is called with the command message.
+func newMessageQuota(v *events.Message) transcription.Quota {
+	if senderLimits == (quota.Limits{}) && chatLimits == (quota.Limits{}) {
+		return nil
+	}
+	sender := resolveSender(v)
+	if v.Info.IsFromMe || authorizer.IsAdmin(sender.Phone()) {
+		return nil
+	}
+	q := &messageQuota{sender: quotaKeys(sender)}
+	if len(q.sender) == 0 {
+		return nil
+	}
+	if v.Info.IsGroup {
+		q.chat = []string{v.Info.Chat.ToNonAD().String()}
+	}
+	return q
+}
+
+// quotaKeys returns the keys a user's usage may be stored under: their phone number in its equivalent
+// forms, then their LID.
+func quotaKeys(id identity.Identity) []string {
+	var keys []string
+	if !id.PN.IsEmpty() {
+		keys = phone.Variants(id.PN.User)
+	}
+	if !id.LID.IsEmpty() {
+		keys = append(keys, id.LID.String())
+	}
+	return keys
+}
+
+// Reserve reserves the seconds from the sender's quota, then the group's. If the group's quota is
+// reached, the sender's reservation is refunded.
+func (q *messageQuota) Reserve(seconds int) (locale.Data, bool) {
+	reservation, period := quotaStore.Reserve(senderLimits, seconds, q.sender...)
+	if period != "" {
+		return quotaData(period, false), false
+	}
+	q.reserved = append(q.reserved, reservation)
+	if len(q.chat) > 0 {
+		reservation, period := quotaStore.Reserve(chatLimits, seconds, q.chat...)
+		if period != "" {
+			q.Refund()
+			return quotaData(period, true), false
+		}
+		q.reserved = append(q.reserved, reservation)
+	}
+	return nil, true
+}
+
+// Refund gives back the seconds reserved from the sender's and group's quotas.
+func (q *messageQuota) Refund() {
+	for _, reservation := range q.reserved {
+		quotaStore.Refund(reservation)
+	}
+	q.reserved = nil
+}
+
+// quotaData describes a reached quota for the "quota.reached" message.
+func quotaData(period quota.Period, chat bool) locale.Data {
+	return locale.Data{
+		"Period": string(period),
+		"Chat":   chat,
+		"Reset":  commands.FormatDuration(quota.Reset(period, time.Now())),
+	}
+}
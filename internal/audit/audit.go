@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Event is an audited action as stored on disk.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Action  string    `json:"action"`
+	Subject string    `json:"subject"`         // Who the action applies to
+	Actor   string    `json:"actor,omitempty"` // Who performed it, if not the subject
+	Chat    string    `json:"chat,omitempty"`  // Chat the action was requested in
+}
+
+// Log appends events to a JSON lines file, kept apart from the data it audits so the history
+// survives changes to that data.
+type Log struct {
+	mu       sync.Mutex
+	filePath string
+	logger   *zap.Logger
+}
+
+// NewLog creates a new Log backed by a JSON lines file.
+func NewLog(filePath string, logger *zap.Logger) *Log {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		logger.Error("Failed to create directory for audit log", zap.String("path", filePath), zap.Error(err))
+	}
+	return &Log{
+		filePath: filePath,
+		logger:   logger,
+	}
+}
+
+// Record appends an event to the log, timestamped now.
+func (l *Log) Record(event Event) {
+	event.Time = time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	file, err := os.OpenFile(l.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		l.logger.Error("Failed to open audit log for writing", zap.String("path", l.filePath), zap.Error(err))
+		return
+	}
+	defer file.Close()
+
+	if err := json.NewEncoder(file).Encode(event); err != nil {
+		l.logger.Error("Failed to write audit event", zap.String("action", event.Action), zap.Error(err))
+		return
+	}
+	l.logger.Info("Audit event recorded", zap.String("action", event.Action), zap.String("subject", event.Subject))
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"sync"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// Authorizer decides who may manage the bot: the owner, i.e. the account the bot runs on,
+// and the configured admins.
+type Authorizer struct {
+	mu           sync.RWMutex
+	owners       map[string]bool // User parts of the owner's JIDs (phone number and LID)
+	admins       map[string]bool
+	selfChatOnly bool
+}
+
+// NewAuthorizer creates an Authorizer with the given admin phone numbers. If selfChatOnly is set,
+// management commands are only accepted in the owner's chat with themselves.
+func NewAuthorizer(admins []string, selfChatOnly bool) *Authorizer {
+	a := &Authorizer{
+		owners:       make(map[string]bool),
+		admins:       make(map[string]bool),
+		selfChatOnly: selfChatOnly,
+	}
+	for _, admin := range admins {
+		a.admins[admin] = true
+	}
+	return a
+}
+
+// SetOwner records the owner's JIDs, typically the device's phone number JID and LID.
+func (a *Authorizer) SetOwner(jids ...types.JID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, jid := range jids {
+		if !jid.IsEmpty() {
+			a.owners[jid.User] = true
+		}
+	}
+}
+
+// IsOwner reports whether the JID belongs to the owner.
+func (a *Authorizer) IsOwner(jid types.JID) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.owners[jid.User]
+}
+
+// IsAdmin reports whether the JID belongs to the owner or a configured admin.
+func (a *Authorizer) IsAdmin(jid types.JID) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.owners[jid.User] || a.admins[jid.User]
+}
+
+// CanManage reports whether management commands from the message source should be accepted.
+func (a *Authorizer) CanManage(source types.MessageSource) bool {
+	if a.selfChatOnly {
+		return source.IsFromMe && !source.IsGroup && a.IsOwner(source.Chat)
+	}
+	return source.IsFromMe || a.IsAdmin(source.Sender)
+}
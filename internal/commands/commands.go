@@ -0,0 +1,168 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/locale"
+)
+
+// Level is the permission level required to run a command.
+type Level int
+
+const (
+	LevelAnyone     Level = iota // Any contact
+	LevelGroupAdmin              // Admins of the group the command is sent in
+	LevelAdmin                   // Configured bot admins
+	LevelOwner                   // The account the bot runs on
+)
+
+// Sink receives the replies of a command. Implementations render message keys from a catalog,
+// so handlers can be exercised without a WhatsApp connection.
+type Sink interface {
+	Reply(key string, data locale.Data)
+	Text(key string, data locale.Data) string
+}
+
+// Context is passed to a command handler.
+type Context struct {
+	Name  string          // Canonical command name, without the slash
+	Args  []string        // Arguments following the command name
+	Event *events.Message // Message the command was received in
+	Level Level           // Permission level of the sender
+	Sink  Sink
+}
+
+// Reply sends a localized reply to the chat the command came from.
+func (c *Context) Reply(key string, data locale.Data) {
+	c.Sink.Reply(key, data)
+}
+
+// Command describes a chat command. Its usage line and description are rendered from the
+// "<name>.usage" and "<name>.help" message keys.
+type Command struct {
+	Name    string   // Canonical name, without the slash
+	Aliases []string // Alternative names, e.g. translations
+	Level   Level    // Minimum permission level
+	// Minimum permission level in groups, if higher than Level. Lets chat settings be changed
+	// by anyone in a direct chat but only by admins in a group.
+	GroupLevel Level
+	// Handle the command even in chats where transcription is turned off, e.g. to turn it on
+	AnyChat bool
+	MinArgs int
+	MaxArgs int // Maximum number of arguments, -1 for no limit
+	Handler func(c *Context)
+}
+
+// Router dispatches command messages to registered commands.
+type Router struct {
+	commands map[string]*Command // Commands keyed by name and aliases
+	ordered  []*Command
+	logger   *zap.Logger
+}
+
+// NewRouter creates a Router with the built-in /help command registered.
+func NewRouter(logger *zap.Logger) *Router {
+	r := &Router{
+		commands: make(map[string]*Command),
+		logger:   logger,
+	}
+	r.Register(&Command{
+		Name:    "help",
+		Aliases: []string{"ajuda", "ayuda"},
+		Level:   LevelAnyone,
+		MaxArgs: 0,
+		Handler: r.help,
+	})
+	return r
+}
+
+// Register adds a command to the router. It panics if the name or an alias is already taken.
+func (r *Router) Register(cmd *Command) {
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		if _, ok := r.commands[name]; ok {
+			panic(fmt.Sprintf("command %q registered twice", name))
+		}
+		r.commands[name] = cmd
+	}
+	r.ordered = append(r.ordered, cmd)
+	sort.Slice(r.ordered, func(i, j int) bool {
+		return r.ordered[i].Name < r.ordered[j].Name
+	})
+}
+
+// Find returns the command registered under a name or alias.
+func (r *Router) Find(name string) (*Command, bool) {
+	cmd, ok := r.commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// Required returns the permission level needed to run the command in the event's chat.
+func (cmd *Command) Required(event *events.Message) Level {
+	if event.Info.IsGroup && cmd.GroupLevel > cmd.Level {
+		return cmd.GroupLevel
+	}
+	return cmd.Level
+}
+
+// Parse splits a command message into its lowercased name and arguments.
+// It returns false if the text is not a command.
+func Parse(text string) (string, []string, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") || len(fields[0]) == 1 {
+		return "", nil, false
+	}
+	return strings.ToLower(fields[0][1:]), fields[1:], true
+}
+
+// Dispatch runs the command in text. It returns false if text is not a known command,
+// in which case the message should be handled as a regular message.
+func (r *Router) Dispatch(text string, event *events.Message, level Level, sink Sink) bool {
+	name, args, ok := Parse(text)
+	if !ok {
+		return false
+	}
+	cmd, ok := r.commands[name]
+	if !ok {
+		return false
+	}
+
+	r.logger.Info("Executing command", zap.String("command", cmd.Name), zap.Strings("args", args))
+	if level < cmd.Required(event) {
+		r.logger.Warn("Command not authorized", zap.String("command", cmd.Name), zap.String("from", event.Info.Sender.String()))
+		sink.Reply("command.not_authorized", nil)
+		return true
+	}
+	if len(args) < cmd.MinArgs || (cmd.MaxArgs >= 0 && len(args) > cmd.MaxArgs) {
+		sink.Reply("command.usage", locale.Data{"Usage": sink.Text(cmd.Name+".usage", nil)})
+		return true
+	}
+
+	cmd.Handler(&Context{
+		Name:  cmd.Name,
+		Args:  args,
+		Event: event,
+		Level: level,
+		Sink:  sink,
+	})
+	return true
+}
+
+// help lists the commands available to the sender.
+func (r *Router) help(c *Context) {
+	var lines []string
+	for _, cmd := range r.ordered {
+		if c.Level < cmd.Required(c.Event) {
+			continue
+		}
+		lines = append(lines, c.Sink.Text("command.help_entry", locale.Data{
+			"Usage": c.Sink.Text(cmd.Name+".usage", nil),
+			"Help":  c.Sink.Text(cmd.Name+".help", nil),
+		}))
+	}
+	c.Reply("command.help", locale.Data{"Commands": lines})
+}
@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/locale"
+)
+
+// recordingSink records the keys replied with. Text renders a key as the key itself, and a help entry
+// as its usage key.
+type recordingSink struct {
+	replies []string
+	data    []locale.Data
+}
+
+func (s *recordingSink) Reply(key string, data locale.Data) {
+	s.replies = append(s.replies, key)
+	s.data = append(s.data, data)
+}
+
+func (s *recordingSink) Text(key string, data locale.Data) string {
+	if key == "command.help_entry" {
+		return data["Usage"].(string)
+	}
+	return key
+}
+
+func message(group bool) *events.Message {
+	return &events.Message{Info: types.MessageInfo{MessageSource: types.MessageSource{IsGroup: group}}}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+		args []string
+		ok   bool
+	}{
+		{text: "/help", name: "help", args: []string{}, ok: true},
+		{text: "/Exclude +55 11 98765-4321", name: "exclude", args: []string{"+55", "11", "98765-4321"}, ok: true},
+		{text: "  /on  ", name: "on", args: []string{}, ok: true},
+		{text: "/excludeXYZ", name: "excludexyz", args: []string{}, ok: true},
+		{text: "/", ok: false},
+		{text: "help", ok: false},
+		{text: "", ok: false},
+		{text: "hello /help", ok: false},
+	}
+	for _, tt := range tests {
+		name, args, ok := Parse(tt.text)
+		if ok != tt.ok || name != tt.name || (ok && !reflect.DeepEqual(args, tt.args)) {
+			t.Errorf("Parse(%q) = %q, %q, %v, want %q, %q, %v", tt.text, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	r := NewRouter(zap.NewNop())
+	var ran []string
+	handler := func(c *Context) {
+		ran = append(ran, c.Name+" "+strings.Join(c.Args, " "))
+	}
+	r.Register(&Command{Name: "exclude", Aliases: []string{"excluir"}, Level: LevelAdmin, MinArgs: 1, MaxArgs: -1, Handler: handler})
+	r.Register(&Command{Name: "locale", Level: LevelAnyone, GroupLevel: LevelGroupAdmin, MinArgs: 1, MaxArgs: 1, Handler: handler})
+
+	tests := []struct {
+		text    string
+		group   bool
+		level   Level
+		handled bool
+		ran     string // Handler run with, empty if it must not run
+		reply   string // Reply sent by the router, empty if none
+	}{
+		{text: "/exclude 5511987654321", level: LevelAdmin, handled: true, ran: "exclude 5511987654321"},
+		{text: "/EXCLUIR 5511987654321", level: LevelOwner, handled: true, ran: "exclude 5511987654321"},
+		{text: "/exclude 5511987654321", level: LevelGroupAdmin, handled: true, reply: "command.not_authorized"},
+		{text: "/exclude", level: LevelAdmin, handled: true, reply: "command.usage"},
+		{text: "/excludeXYZ", level: LevelOwner, handled: false},
+		{text: "/unknown", level: LevelOwner, handled: false},
+		{text: "not a command", level: LevelOwner, handled: false},
+		{text: "/locale pt", level: LevelAnyone, handled: true, ran: "locale pt"},
+		{text: "/locale pt", group: true, level: LevelAnyone, handled: true, reply: "command.not_authorized"},
+		{text: "/locale pt", group: true, level: LevelGroupAdmin, handled: true, ran: "locale pt"},
+		{text: "/locale pt en", level: LevelAnyone, handled: true, reply: "command.usage"},
+	}
+	for _, tt := range tests {
+		ran = nil
+		sink := &recordingSink{}
+		handled := r.Dispatch(tt.text, message(tt.group), tt.level, sink)
+		if handled != tt.handled {
+			t.Errorf("Dispatch(%q) = %v, want %v", tt.text, handled, tt.handled)
+		}
+		if got := strings.Join(ran, ","); got != tt.ran {
+			t.Errorf("Dispatch(%q) ran %q, want %q", tt.text, got, tt.ran)
+		}
+		if got := strings.Join(sink.replies, ","); got != tt.reply {
+			t.Errorf("Dispatch(%q) replied %q, want %q", tt.text, got, tt.reply)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	r := NewRouter(zap.NewNop())
+	noop := func(c *Context) {}
+	r.Register(&Command{Name: "on", Level: LevelAnyone, GroupLevel: LevelGroupAdmin, Handler: noop})
+	r.Register(&Command{Name: "exclude", Level: LevelAdmin, Handler: noop})
+	r.Register(&Command{Name: "cancel", Level: LevelAnyone, Handler: noop})
+
+	tests := []struct {
+		group bool
+		level Level
+		want  []string
+	}{
+		{level: LevelAnyone, want: []string{"cancel", "help", "on"}},
+		{group: true, level: LevelAnyone, want: []string{"cancel", "help"}},
+		{group: true, level: LevelGroupAdmin, want: []string{"cancel", "help", "on"}},
+		{level: LevelAdmin, want: []string{"cancel", "exclude", "help", "on"}},
+	}
+	for _, tt := range tests {
+		sink := &recordingSink{}
+		r.Dispatch("/help", message(tt.group), tt.level, sink)
+		if len(sink.replies) != 1 || sink.replies[0] != "command.help" {
+			t.Fatalf("/help replied %q, want command.help", sink.replies)
+		}
+		var got []string
+		for _, entry := range sink.data[0]["Commands"].([]string) {
+			got = append(got, strings.TrimSuffix(entry, ".usage"))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("/help in group=%v at level %d listed %q, want %q", tt.group, tt.level, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationUnits maps the unit suffixes accepted by ParseDuration to their length.
+var durationUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseDuration parses a duration argument such as "30m", "2h", "3d" or "1d12h".
+// Unlike time.ParseDuration it accepts days and weeks, and only whole numbers.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	var total time.Duration
+	for s != "" {
+		i := 0
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if i == 0 || i == len(s) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		unit, ok := durationUnits[s[i]]
+		if !ok {
+			return 0, fmt.Errorf("unknown unit %q in duration", s[i])
+		}
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		total += time.Duration(n) * unit
+		s = s[i+1:]
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return total, nil
+}
+
+// FormatDuration formats a duration for chat replies, e.g. "2d 3h" or "45m", rounded up to the minute.
+func FormatDuration(d time.Duration) string {
+	minutes := int((d + time.Minute - 1) / time.Minute)
+	days, hours, minutes := minutes/(24*60), minutes/60%24, minutes%60
+
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 && days == 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if len(parts) == 0 {
+		return "0m"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "30s", want: 30 * time.Second},
+		{input: "30m", want: 30 * time.Minute},
+		{input: "2h", want: 2 * time.Hour},
+		{input: "3d", want: 72 * time.Hour},
+		{input: "1w", want: 7 * 24 * time.Hour},
+		{input: "1d12h", want: 36 * time.Hour},
+		{input: " 2H ", want: 2 * time.Hour},
+		{input: "", wantErr: true},
+		{input: "10", wantErr: true},
+		{input: "h", wantErr: true},
+		{input: "1.5h", wantErr: true},
+		{input: "5y", wantErr: true},
+		{input: "-1h", wantErr: true},
+		{input: "0m", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDuration(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDuration(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseDuration(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: 0, want: "0m"},
+		{d: 30 * time.Second, want: "1m"},
+		{d: 45 * time.Minute, want: "45m"},
+		{d: 2*time.Hour + 5*time.Minute, want: "2h 5m"},
+		{d: 51*time.Hour + 30*time.Minute, want: "2d 3h"},
+	}
+	for _, tt := range tests {
+		if got := FormatDuration(tt.d); got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
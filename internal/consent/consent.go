@@ -0,0 +1,119 @@
+package consent
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/jsonfile"
+)
+
+// Held is an audio message waiting for its sender's consent.
+type Held struct {
+	Chat string `json:"chat"`
+	ID   string `json:"id"`
+}
+
+// Record is the consent state of a contact.
+type Record struct {
+	Notified  time.Time `json:"notified"`            // When the notice was sent
+	Mode      string    `json:"mode,omitempty"`      // Consent mode the notice was sent in, "notice" if empty
+	Consented time.Time `json:"consented,omitempty"` // When the contact replied to the notice, in wait mode
+	Held      []Held    `json:"held,omitempty"`      // Audio waiting for consent, in wait mode
+}
+
+// Store tracks which contacts were sent the first-contact notice and which consented.
+type Store struct {
+	mu       sync.Mutex
+	records  map[string]Record
+	filePath string
+	logger   *zap.Logger
+}
+
+// NewStore creates a new Store backed by a JSON file.
+func NewStore(filePath string, logger *zap.Logger) *Store {
+	s := &Store{
+		records:  make(map[string]Record),
+		filePath: filePath,
+		logger:   logger,
+	}
+	s.load()
+	return s
+}
+
+// load reads the consent file into memory.
+func (s *Store) load() {
+	found, err := jsonfile.Load(s.filePath, &s.records)
+	if err != nil {
+		s.logger.Error("Failed to load consent file", zap.String("path", s.filePath), zap.Error(err))
+		return
+	}
+	if found {
+		s.logger.Info("Consent records loaded", zap.Int("count", len(s.records)))
+	}
+}
+
+// save writes the records over the consent file.
+func (s *Store) save() {
+	if err := jsonfile.Save(s.filePath, s.records); err != nil {
+		s.logger.Error("Failed to save consent file", zap.String("path", s.filePath), zap.Error(err))
+	}
+}
+
+// Find returns the record of a contact and the key it is stored under, trying each of the contact's keys.
+func (s *Store) Find(keys ...string) (string, Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		if record, ok := s.records[key]; ok {
+			return key, record, true
+		}
+	}
+	return "", Record{}, false
+}
+
+// Notify records that the notice of a consent mode was sent to a contact. It returns false if the
+// contact was already notified, so the notice is only sent once. Contacts who were only sent the
+// notice of "notice" mode are notified again in "wait" mode, since they were never asked to reply.
+func (s *Store) Notify(key, mode string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if ok && (record.Mode == mode || record.Mode == "wait") {
+		return false
+	}
+	record.Notified, record.Mode = time.Now(), mode
+	s.records[key] = record
+	s.save()
+	s.logger.Info("Consent notice recorded", zap.String("contact", key), zap.String("mode", mode))
+	return true
+}
+
+// Hold adds an audio message to the ones waiting for the contact's consent.
+func (s *Store) Hold(key string, held Held) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[key]
+	record.Held = append(record.Held, held)
+	s.records[key] = record
+	s.save()
+}
+
+// Consent records that a contact consented and returns the audio held until then. It returns false
+// if the contact was not waiting for consent.
+func (s *Store) Consent(key string) ([]Held, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	if !ok || !record.Consented.IsZero() {
+		return nil, false
+	}
+	held := record.Held
+	record.Consented = time.Now()
+	record.Held = nil
+	s.records[key] = record
+	s.save()
+	s.logger.Info("Consent recorded", zap.String("contact", key), zap.Int("held", len(held)))
+	return held, true
+}
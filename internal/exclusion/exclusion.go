@@ -2,106 +2,422 @@ package exclusion
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/jsonfile"
+	"whatsapp-transcriber-go/internal/phone"
 )
 
-// Manager handles the exclusion list for phone numbers and group chats.
+// Manager handles the exclusion list for phone numbers and group chats. The same list format also
+// backs the allowlist used in allow mode.
+// Phone numbers are stored normalized to E.164 digits, while other JIDs such as groups are stored as is.
+// The list is stored as JSON lines, one Entry per line, and rewritten atomically on every change.
+// Edits made to the file by hand are picked up by Watch.
 type Manager struct {
-	excluded sync.Map // Stores excluded numbers/JIDs as map[string]bool
-	filePath string
-	logger   *zap.Logger
+	excluded    sync.Map   // Stores excluded numbers/JIDs as map[string]Entry
+	mu          sync.Mutex // Serializes changes, reloads and writes of the list file
+	modTime     time.Time  // Modification time of the list file when last read or written
+	size        int64      // Size of the list file when last read or written
+	filePath    string
+	countryCode string // Default country code for numbers entered without one
+	logger      *zap.Logger
+}
+
+// Details describes why and by whom a number/JID was added, and for how long.
+type Details struct {
+	Expires time.Time `json:"expires,omitempty"` // Zero for permanent entries
+	Reason  string    `json:"reason,omitempty"`
+	Author  string    `json:"author,omitempty"` // Who added the entry, e.g. an admin's phone number
+	Self    bool      `json:"self,omitempty"`   // Added by the contact themselves with /stop
+}
+
+// Entry is an excluded number/JID as stored in the list file.
+type Entry struct {
+	JID string `json:"jid"`
+	Details
+	Created time.Time `json:"created"`
+}
+
+// MarshalJSON omits the expiry of permanent entries.
+func (e Entry) MarshalJSON() ([]byte, error) {
+	type plain Entry
+	var expires *time.Time
+	if !e.Expires.IsZero() {
+		expires = &e.Expires
+	}
+	return json.Marshal(struct {
+		plain
+		Expires *time.Time `json:"expires,omitempty"`
+	}{plain(e), expires})
+}
+
+// expired reports whether a temporary entry has expired.
+func (e Entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && now.After(e.Expires)
 }
 
-// NewManager creates a new ExclusionListManager.
-func NewManager(filePath string, logger *zap.Logger) *Manager {
+// NewManager creates a new ExclusionListManager. Log entries are tagged with the file name, so
+// several lists can be told apart.
+func NewManager(filePath, countryCode string, logger *zap.Logger) *Manager {
 	m := &Manager{
-		filePath: filePath,
-		logger:   logger,
+		filePath:    filePath,
+		countryCode: countryCode,
+		logger:      logger.With(zap.String("list", filepath.Base(filePath))),
 	}
 	m.loadExcludedNumbers()
 	return m
 }
 
-// loadExcludedNumbers loads numbers from the exclusion file into the map.
+// loadExcludedNumbers loads entries from the list file into the map, dropping expired ones.
 func (m *Manager) loadExcludedNumbers() {
-	// Ensure the directory exists
-	dir := filepath.Dir(m.filePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		m.logger.Error("Failed to create directory for exclusion file", zap.String("path", dir), zap.Error(err))
+	if err := os.MkdirAll(filepath.Dir(m.filePath), 0755); err != nil {
+		m.logger.Error("Failed to create directory for exclusion file", zap.String("path", m.filePath), zap.Error(err))
 		return
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh(true)
+	m.logger.Info("Exclusion list loaded", zap.Int("count", m.Count()))
+}
 
-	file, err := os.OpenFile(m.filePath, os.O_RDONLY|os.O_CREATE, 0644)
+// refresh reloads the list file if it changed on disk since it was last read or written, replacing
+// the entries in memory. The caller must hold m.mu, so changes made through commands are applied on
+// top of the reloaded entries instead of overwriting a hand-edited file.
+func (m *Manager) refresh(force bool) {
+	info, err := os.Stat(m.filePath)
 	if err != nil {
-		m.logger.Error("Failed to open exclusion file", zap.String("path", m.filePath), zap.Error(err))
+		if !os.IsNotExist(err) {
+			m.logger.Error("Failed to stat exclusion file", zap.String("path", m.filePath), zap.Error(err))
+			return
+		}
+		if m.modTime.IsZero() {
+			return
+		}
+		// The file was deleted by hand, which empties the list
+		info = nil
+	} else if !force && info.ModTime().Equal(m.modTime) && info.Size() == m.size {
 		return
 	}
+
+	entries := make(map[string]Entry)
+	rewrite := false
+	if info != nil {
+		if entries, rewrite, err = m.readFile(); err != nil {
+			m.logger.Error("Failed to read exclusion file", zap.String("path", m.filePath), zap.Error(err))
+			return
+		}
+		m.modTime, m.size = info.ModTime(), info.Size()
+	} else {
+		m.modTime, m.size = time.Time{}, 0
+	}
+
+	m.excluded.Range(func(key, value interface{}) bool {
+		if _, ok := entries[key.(string)]; !ok {
+			m.excluded.Delete(key)
+		}
+		return true
+	})
+	for jid, entry := range entries {
+		m.excluded.Store(jid, entry)
+	}
+	if !force {
+		m.logger.Info("Exclusion list reloaded", zap.Int("count", len(entries)))
+	}
+	if rewrite {
+		m.saveExcludedNumbers()
+	}
+}
+
+// readFile parses the list file. Expired entries are dropped and phone numbers normalized; rewrite
+// reports whether the file should be rewritten because of either.
+func (m *Manager) readFile() (entries map[string]Entry, rewrite bool, err error) {
+	file, err := os.Open(m.filePath)
+	if err != nil {
+		return nil, false, err
+	}
 	defer file.Close()
 
+	entries = make(map[string]Entry)
+	now := time.Now()
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		number := scanner.Text()
-		if number != "" {
-			m.excluded.Store(number, true)
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.JID == "" {
+			m.logger.Warn("Skipping invalid exclusion entry", zap.String("line", scanner.Text()), zap.Error(err))
+			continue
 		}
+		if entry.expired(now) {
+			m.logger.Info("Dropping expired exclusion", zap.String("jid", entry.JID))
+			rewrite = true
+			continue
+		}
+		// Stored numbers are international; only numbers typed in another format by hand are normalized
+		if _, err := m.key(entry.JID); err != nil {
+			if normalized, err := m.Normalize(entry.JID); err == nil {
+				m.logger.Info("Migrating exclusion entry", zap.String("from", entry.JID), zap.String("to", normalized))
+				entry.JID = normalized
+				rewrite = true
+			}
+		}
+		entries[entry.JID] = entry
 	}
+	return entries, rewrite, scanner.Err()
+}
 
-	if err := scanner.Err(); err != nil {
-		m.logger.Error("Error reading exclusion file", zap.String("path", m.filePath), zap.Error(err))
+// Watch polls the list file for changes every interval until ctx is done, so hand edits take effect
+// without a restart. Expired entries are purged at the same time.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.mu.Lock()
+				m.refresh(false)
+				m.purgeExpired()
+				m.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// purgeExpired removes expired entries and saves the list if any were removed. The caller must hold m.mu.
+func (m *Manager) purgeExpired() {
+	purged := false
+	now := time.Now()
+	m.excluded.Range(func(key, value interface{}) bool {
+		if value.(Entry).expired(now) {
+			m.excluded.Delete(key)
+			m.logger.Info("Exclusion expired", zap.String("jid", key.(string)))
+			purged = true
+		}
+		return true
+	})
+	if purged {
+		m.saveExcludedNumbers()
 	}
-	m.logger.Info("Exclusion list loaded", zap.Int("count", m.Count()))
 }
 
-// saveExcludedNumbers saves the current exclusion list to the file.
-func (m *Manager) saveExcludedNumbers() {
-	file, err := os.Create(m.filePath)
+// ImportLegacy imports a list in the legacy text format, one number per line optionally followed by
+// an RFC 3339 expiry, and renames it to "<path>.imported" so it is only imported once. Entries already
+// on the list are kept. It returns the number of imported entries; a missing file is not an error.
+func (m *Manager) ImportLegacy(path string) (int, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		m.logger.Error("Failed to create exclusion file for writing", zap.String("path", m.filePath), zap.Error(err))
-		return
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to open legacy exclusion file: %w", err)
 	}
 	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	m.excluded.Range(func(key, value interface{}) bool {
-		_, err := writer.WriteString(key.(string) + "\n")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh(false)
+	imported := 0
+	now := time.Now()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		jid, expires := parseLine(line)
+		entry := Entry{JID: jid, Details: Details{Expires: expires, Reason: "Imported from " + filepath.Base(path)}, Created: now}
+		if entry.expired(now) {
+			continue
+		}
+		// Legacy entries are JID users, already international; only hand-typed numbers are normalized
+		normalized, err := m.key(jid)
 		if err != nil {
-			m.logger.Error("Failed to write number to exclusion file", zap.String("number", key.(string)), zap.Error(err))
-			return false
+			normalized, err = m.Normalize(jid)
 		}
-		return true
+		if err != nil {
+			m.logger.Warn("Keeping invalid entry in exclusion file as is", zap.String("entry", jid), zap.Error(err))
+			normalized = jid
+		}
+		entry.JID = normalized
+		if _, ok := m.find(normalized); ok {
+			continue
+		}
+		m.excluded.Store(normalized, entry)
+		imported++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read legacy exclusion file: %w", err)
+	}
+	file.Close()
+
+	if !m.saveExcludedNumbers() {
+		return 0, fmt.Errorf("failed to save imported entries to %s", m.filePath)
+	}
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return imported, fmt.Errorf("failed to rename legacy exclusion file: %w", err)
+	}
+	m.logger.Info("Imported legacy exclusion file", zap.String("path", path), zap.Int("count", imported))
+	return imported, nil
+}
+
+// parseLine splits a line of a legacy exclusion file into the entry and its optional expiry.
+func parseLine(line string) (string, time.Time) {
+	if i := strings.LastIndexByte(line, ' '); i >= 0 {
+		if expires, err := time.Parse(time.RFC3339, line[i+1:]); err == nil {
+			return strings.TrimSpace(line[:i]), expires
+		}
+	}
+	return line, time.Time{}
+}
+
+// Normalize converts a phone number as typed by a user to the stored form. JIDs with a server part,
+// such as groups, are kept as is.
+func (m *Manager) Normalize(jid string) (string, error) {
+	jid = strings.TrimSpace(jid)
+	if strings.Contains(jid, "@") {
+		return jid, nil
+	}
+	return phone.Normalize(jid, m.countryCode)
+}
+
+// key validates a number/JID already in the stored form, such as the user part of a phone number JID.
+func (m *Manager) key(jid string) (string, error) {
+	jid = strings.TrimSpace(jid)
+	if strings.Contains(jid, "@") {
+		return jid, nil
+	}
+	return phone.FromJID(jid)
+}
+
+// saveExcludedNumbers replaces the list file with the current entries. It reports whether the list
+// was saved. The caller must hold m.mu.
+func (m *Manager) saveExcludedNumbers() bool {
+	entries := m.all()
+	err := jsonfile.Replace(m.filePath, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return fmt.Errorf("entry %s: %w", entry.JID, err)
+			}
+		}
+		return nil
 	})
-	writer.Flush()
-	m.logger.Info("Exclusion list saved", zap.Int("count", m.Count()))
+	if err != nil {
+		m.logger.Error("Failed to save exclusion file", zap.String("path", m.filePath), zap.Error(err))
+		return false
+	}
+	// Remember our own write, so it isn't mistaken for a hand edit
+	if info, err := os.Stat(m.filePath); err == nil {
+		m.modTime, m.size = info.ModTime(), info.Size()
+	}
+	m.logger.Info("Exclusion list saved", zap.Int("count", len(entries)))
+	return true
 }
 
-// IsExcluded checks if a number/JID is in the exclusion list.
+// IsExcluded checks if a number/JID is in the exclusion list, in any of its equivalent forms.
 func (m *Manager) IsExcluded(jid string) bool {
-	_, ok := m.excluded.Load(jid)
+	return m.Contains(jid)
+}
+
+// Contains checks if a number/JID is on the list, in any of its equivalent forms. It reads better
+// than IsExcluded when the list is used as an allowlist.
+func (m *Manager) Contains(jid string) bool {
+	_, ok := m.find(jid)
 	return ok
 }
 
-// Add adds a number/JID to the exclusion list.
-func (m *Manager) Add(jid string) {
-	if _, loaded := m.excluded.LoadOrStore(jid, true); !loaded {
-		m.logger.Info("Added to exclusion list", zap.String("jid", jid))
-		m.saveExcludedNumbers()
-	} else {
-		m.logger.Debug("JID already in exclusion list", zap.String("jid", jid))
+// find returns the stored entry matching a number/JID in the stored form, trying the equivalent forms
+// of phone numbers. Expired entries are ignored; Watch removes them.
+func (m *Manager) find(jid string) (string, bool) {
+	candidates := []string{jid}
+	if number, err := phone.FromJID(jid); err == nil {
+		candidates = phone.Variants(number)
 	}
+
+	for _, candidate := range candidates {
+		value, ok := m.excluded.Load(candidate)
+		if !ok {
+			continue
+		}
+		if value.(Entry).expired(time.Now()) {
+			continue
+		}
+		return candidate, true
+	}
+	return jid, false
 }
 
-// Remove removes a number/JID from the exclusion list.
-func (m *Manager) Remove(jid string) {
-	if _, loaded := m.excluded.LoadAndDelete(jid); loaded {
-		m.logger.Info("Removed from exclusion list", zap.String("jid", jid))
-		m.saveExcludedNumbers()
-	} else {
+// Add adds a number/JID to the exclusion list. Numbers must be in international form, as in JIDs or
+// returned by Normalize. It returns the stored form of the number, or an error if the number is
+// invalid. Adding an already excluded number replaces its details but keeps its creation time.
+func (m *Manager) Add(jid string, details Details) (string, error) {
+	normalized, err := m.key(jid)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh(false)
+	entry := Entry{JID: normalized, Details: details, Created: time.Now()}
+	if existing, ok := m.find(normalized); ok {
+		value, _ := m.excluded.Load(existing)
+		previous := value.(Entry)
+		if previous.Details == details {
+			m.logger.Debug("JID already in exclusion list", zap.String("jid", existing))
+			return existing, nil
+		}
+		entry.JID, entry.Created = existing, previous.Created
+	}
+	m.excluded.Store(entry.JID, entry)
+	m.logger.Info("Added to exclusion list", zap.String("jid", entry.JID), zap.Time("expires", details.Expires),
+		zap.String("author", details.Author), zap.String("reason", details.Reason))
+	m.saveExcludedNumbers()
+	return entry.JID, nil
+}
+
+// Get returns the entry matching a number/JID, in any of its equivalent forms.
+func (m *Manager) Get(jid string) (Entry, bool) {
+	existing, ok := m.find(jid)
+	if !ok {
+		return Entry{}, false
+	}
+	value, ok := m.excluded.Load(existing)
+	if !ok {
+		return Entry{}, false
+	}
+	return value.(Entry), true
+}
+
+// Remove removes a number/JID from the exclusion list. It reports whether it was found.
+func (m *Manager) Remove(jid string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refresh(false)
+	existing, ok := m.find(jid)
+	if !ok {
 		m.logger.Debug("JID not found in exclusion list", zap.String("jid", jid))
+		return false
 	}
+	m.excluded.Delete(existing)
+	m.logger.Info("Removed from exclusion list", zap.String("jid", existing))
+	m.saveExcludedNumbers()
+	return true
 }
 
 // Count returns the number of entries in the exclusion list.
@@ -117,9 +433,33 @@ func (m *Manager) Count() int {
 // GetAllExcluded returns all excluded numbers/JIDs as a slice of strings.
 func (m *Manager) GetAllExcluded() []string {
 	var excluded []string
+	for _, entry := range m.Entries() {
+		excluded = append(excluded, entry.JID)
+	}
+	return excluded
+}
+
+// Entries returns all unexpired entries of the exclusion list, sorted by number/JID.
+func (m *Manager) Entries() []Entry {
+	var entries []Entry
+	now := time.Now()
+	for _, entry := range m.all() {
+		if !entry.expired(now) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// all returns every stored entry, sorted by number/JID.
+func (m *Manager) all() []Entry {
+	var entries []Entry
 	m.excluded.Range(func(key, value interface{}) bool {
-		excluded = append(excluded, key.(string))
+		entries = append(entries, value.(Entry))
 		return true
 	})
-	return excluded
-}
\ No newline at end of file
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].JID < entries[j].JID
+	})
+	return entries
+}
@@ -0,0 +1,87 @@
+package exclusion
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exclude.jsonl")
+	m := NewManager(path, "55", zap.NewNop())
+	for _, input := range []string{"+33 6 12 34 56 78", "+1 202 555 0123", "(11) 98765-4321", "120363012345678901@g.us"} {
+		number, err := m.Normalize(input)
+		if err != nil {
+			t.Fatalf("Normalize(%q) failed: %v", input, err)
+		}
+		if _, err := m.Add(number, Details{}); err != nil {
+			t.Fatalf("Add(%q) failed: %v", number, err)
+		}
+	}
+
+	tests := []struct {
+		key  string
+		want string
+		ok   bool
+	}{
+		{key: "33612345678", want: "33612345678", ok: true},
+		{key: "12025550123", want: "12025550123", ok: true},
+		{key: "5511987654321", want: "5511987654321", ok: true},
+		{key: "551187654321", want: "5511987654321", ok: true}, // Without the ninth digit
+		{key: "120363012345678901@g.us", want: "120363012345678901@g.us", ok: true},
+		{key: "5533612345678", want: "5533612345678", ok: false},
+		{key: "44612345678", want: "44612345678", ok: false},
+	}
+	check := func(m *Manager) {
+		t.Helper()
+		for _, tt := range tests {
+			got, ok := m.find(tt.key)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("find(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.ok)
+			}
+		}
+	}
+	check(m)
+
+	// Stored numbers must not be normalized again when the list is loaded
+	check(NewManager(path, "55", zap.NewNop()))
+}
+
+func TestImportLegacy(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "exclude.txt")
+	lines := "33612345678\n+1 202 555 0123\n(11) 98765-4321\n120363012345678901@g.us\n5521987654321 2000-01-01T00:00:00Z\n"
+	if err := os.WriteFile(legacy, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(filepath.Join(dir, "exclude.jsonl"), "55", zap.NewNop())
+	imported, err := m.ImportLegacy(legacy)
+	if err != nil {
+		t.Fatalf("ImportLegacy failed: %v", err)
+	}
+	if imported != 4 {
+		t.Errorf("ImportLegacy imported %d entries, want 4", imported)
+	}
+
+	tests := []struct {
+		key string
+		ok  bool
+	}{
+		{key: "33612345678", ok: true},
+		{key: "12025550123", ok: true},
+		{key: "5511987654321", ok: true},
+		{key: "120363012345678901@g.us", ok: true},
+		{key: "5533612345678", ok: false}, // A JID user must not get the default country code
+		{key: "5521987654321", ok: false}, // Expired
+	}
+	for _, tt := range tests {
+		if _, ok := m.find(tt.key); ok != tt.ok {
+			t.Errorf("find(%q) after import = %v, want %v", tt.key, ok, tt.ok)
+		}
+	}
+	if _, err := os.Stat(legacy + ".imported"); err != nil {
+		t.Errorf("Legacy file was not renamed: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package identity
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.uber.org/zap"
+)
+
+// Identity holds both addressing forms of a WhatsApp user. Either may be empty if unknown.
+type Identity struct {
+	PN  types.JID // Phone number JID, e.g. 5511987654321@s.whatsapp.net
+	LID types.JID // Hidden user JID, e.g. 123456789012345@lid
+}
+
+// Phone returns the phone number JID if known, and the LID otherwise.
+func (i Identity) Phone() types.JID {
+	if !i.PN.IsEmpty() {
+		return i.PN
+	}
+	return i.LID
+}
+
+// Keys returns the strings the identity is matched against in exclusion lists and settings:
+// the bare phone number and the full LID JID.
+func (i Identity) Keys() []string {
+	var keys []string
+	if !i.PN.IsEmpty() {
+		keys = append(keys, i.PN.User)
+	}
+	if !i.LID.IsEmpty() {
+		keys = append(keys, i.LID.String())
+	}
+	return keys
+}
+
+// Resolver maps between phone number JIDs and LIDs using whatsmeow's LID store.
+type Resolver struct {
+	lids   store.LIDStore
+	logger *zap.Logger
+}
+
+// NewResolver creates a new Resolver.
+func NewResolver(lids store.LIDStore, logger *zap.Logger) *Resolver {
+	return &Resolver{
+		lids:   lids,
+		logger: logger,
+	}
+}
+
+// Resolve returns both forms of a user JID. alt is the alternative address WhatsApp sent along with
+// the message, if any; otherwise the mapping is looked up in the store.
+func (r *Resolver) Resolve(ctx context.Context, jid, alt types.JID) Identity {
+	var id Identity
+	for _, candidate := range []types.JID{jid, alt} {
+		candidate = candidate.ToNonAD()
+		switch candidate.Server {
+		case types.DefaultUserServer:
+			if id.PN.IsEmpty() {
+				id.PN = candidate
+			}
+		case types.HiddenUserServer:
+			if id.LID.IsEmpty() {
+				id.LID = candidate
+			}
+		}
+	}
+
+	if id.PN.IsEmpty() && !id.LID.IsEmpty() {
+		pn, err := r.lids.GetPNForLID(ctx, id.LID)
+		if err != nil {
+			r.logger.Warn("Failed to look up phone number for LID", zap.String("lid", id.LID.String()), zap.Error(err))
+		}
+		id.PN = pn
+	} else if id.LID.IsEmpty() && !id.PN.IsEmpty() {
+		lid, err := r.lids.GetLIDForPN(ctx, id.PN)
+		if err != nil {
+			r.logger.Warn("Failed to look up LID for phone number", zap.String("pn", id.PN.String()), zap.Error(err))
+		}
+		id.LID = lid
+	}
+	return id
+}
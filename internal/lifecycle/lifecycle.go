@@ -0,0 +1,224 @@
+package lifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// cancelGracePeriod is how long Shutdown waits for jobs to return after their context was cancelled.
+const cancelGracePeriod = 5 * time.Second
+
+// task is a running job.
+type task struct {
+	payload json.RawMessage
+	group   string
+	owner   string
+	cancel  context.CancelFunc
+	started time.Time
+}
+
+// Manager tracks background jobs so the bot can shut down without dropping work in flight.
+type Manager struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	closing    bool
+	running    map[string]*task  // Jobs that are still running, keyed by job ID
+	unfinished []json.RawMessage // Payloads of jobs interrupted by shutdown
+	filePath   string
+	logger     *zap.Logger
+}
+
+// NewManager creates a new lifecycle Manager that persists unfinished jobs to filePath.
+func NewManager(filePath string, logger *zap.Logger) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		ctx:      ctx,
+		cancel:   cancel,
+		running:  make(map[string]*task),
+		filePath: filePath,
+		logger:   logger,
+	}
+}
+
+// Context returns the root context shared by all jobs. It is cancelled when shutdown gives up waiting.
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Go runs fn in a tracked goroutine. The payload is persisted if the job is interrupted by shutdown,
+// group lets the most recent job of e.g. a chat be looked up for cancellation, and owner identifies
+// who may cancel it besides admins.
+// It returns false without running fn if the manager is shutting down or a job with the same ID is running.
+func (m *Manager) Go(id, group, owner string, payload interface{}, fn func(ctx context.Context) error) bool {
+	var raw json.RawMessage
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			m.logger.Error("Failed to marshal job payload", zap.String("id", id), zap.Error(err))
+		} else {
+			raw = data
+		}
+	}
+
+	m.mu.Lock()
+	if m.closing {
+		m.mu.Unlock()
+		m.logger.Info("Rejecting job, shutting down", zap.String("id", id))
+		return false
+	}
+	if _, ok := m.running[id]; ok {
+		m.mu.Unlock()
+		m.logger.Debug("Job already running", zap.String("id", id))
+		return false
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.running[id] = &task{
+		payload: raw,
+		group:   group,
+		owner:   owner,
+		cancel:  cancel,
+		started: time.Now(),
+	}
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		defer cancel()
+		err := fn(ctx)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.running, id)
+		if err != nil && errors.Is(err, context.Canceled) && m.ctx.Err() != nil && raw != nil {
+			m.unfinished = append(m.unfinished, raw)
+		}
+	}()
+	return true
+}
+
+// Shutdown stops accepting new jobs and waits up to timeout for running ones.
+// Jobs still running after the deadline are cancelled, and all unfinished jobs are persisted.
+func (m *Manager) Shutdown(timeout time.Duration) {
+	m.mu.Lock()
+	m.closing = true
+	count := len(m.running)
+	m.mu.Unlock()
+
+	m.logger.Info("Waiting for running jobs to finish", zap.Int("count", count), zap.Duration("timeout", timeout))
+	if !m.wait(timeout) {
+		m.logger.Warn("Shutdown deadline reached, cancelling remaining jobs")
+		m.cancel()
+		if !m.wait(cancelGracePeriod) {
+			m.logger.Error("Jobs did not stop after cancellation")
+		}
+	}
+	m.cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := append([]json.RawMessage{}, m.unfinished...)
+	for _, t := range m.running {
+		if t.payload != nil {
+			pending = append(pending, t.payload)
+		}
+	}
+	m.savePending(pending)
+}
+
+// Cancel cancels the running job with the given ID, if owned by owner or for any owner if empty.
+// It reports whether the job was found.
+func (m *Manager) Cancel(id, owner string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.running[id]
+	if !ok || (owner != "" && t.owner != owner) {
+		return false
+	}
+	t.cancel()
+	m.logger.Info("Job cancelled", zap.String("id", id))
+	return true
+}
+
+// Latest returns the ID of the most recently started job in the group, owned by owner or by anyone
+// if empty.
+func (m *Manager) Latest(group, owner string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latestID string
+	var latest *task
+	for id, t := range m.running {
+		if t.group == group && (owner == "" || t.owner == owner) && (latest == nil || t.started.After(latest.started)) {
+			latestID, latest = id, t
+		}
+	}
+	return latestID, latest != nil
+}
+
+// wait blocks until all jobs have returned or timeout elapses. It reports whether all jobs returned.
+func (m *Manager) wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// savePending writes the payloads of unfinished jobs to the pending file.
+func (m *Manager) savePending(pending []json.RawMessage) {
+	if len(pending) == 0 {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.filePath), 0755); err != nil {
+		m.logger.Error("Failed to create directory for pending jobs file", zap.String("path", m.filePath), zap.Error(err))
+		return
+	}
+	data, err := json.Marshal(pending)
+	if err != nil {
+		m.logger.Error("Failed to marshal pending jobs", zap.Error(err))
+		return
+	}
+	if err := os.WriteFile(m.filePath, data, 0644); err != nil {
+		m.logger.Error("Failed to write pending jobs file", zap.String("path", m.filePath), zap.Error(err))
+		return
+	}
+	m.logger.Info("Persisted unfinished jobs", zap.Int("count", len(pending)), zap.String("path", m.filePath))
+}
+
+// LoadPending returns the payloads persisted by a previous shutdown and removes the pending file.
+func (m *Manager) LoadPending() []json.RawMessage {
+	data, err := os.ReadFile(m.filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			m.logger.Error("Failed to read pending jobs file", zap.String("path", m.filePath), zap.Error(err))
+		}
+		return nil
+	}
+
+	var pending []json.RawMessage
+	if err := json.Unmarshal(data, &pending); err != nil {
+		m.logger.Error("Failed to parse pending jobs file", zap.String("path", m.filePath), zap.Error(err))
+		return nil
+	}
+	if err := os.Remove(m.filePath); err != nil {
+		m.logger.Error("Failed to remove pending jobs file", zap.String("path", m.filePath), zap.Error(err))
+	}
+	m.logger.Info("Loaded unfinished jobs", zap.Int("count", len(pending)))
+	return pending
+}
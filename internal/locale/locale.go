@@ -0,0 +1,132 @@
+package locale
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+)
+
+//go:embed catalogs/*.json
+var builtin embed.FS
+
+// Data holds the values available to a message template.
+type Data map[string]interface{}
+
+// Catalog holds the message templates of every locale.
+type Catalog struct {
+	templates map[string]map[string]*template.Template // Templates keyed by locale, then message key
+	fallback  string
+	logger    *zap.Logger
+}
+
+// NewCatalog creates a Catalog from the built-in catalogs, overridden by any <locale>.json files in
+// overrideDir. Messages missing from a locale are rendered from the fallback locale.
+func NewCatalog(overrideDir, fallback string, logger *zap.Logger) *Catalog {
+	c := &Catalog{
+		templates: make(map[string]map[string]*template.Template),
+		fallback:  fallback,
+		logger:    logger,
+	}
+
+	files, _ := builtin.ReadDir("catalogs")
+	for _, file := range files {
+		data, err := builtin.ReadFile(path.Join("catalogs", file.Name()))
+		if err != nil {
+			logger.Error("Failed to read built-in catalog", zap.String("file", file.Name()), zap.Error(err))
+			continue
+		}
+		c.load(strings.TrimSuffix(file.Name(), ".json"), data)
+	}
+
+	overrides, _ := filepath.Glob(filepath.Join(overrideDir, "*.json"))
+	for _, file := range overrides {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			logger.Error("Failed to read message catalog", zap.String("path", file), zap.Error(err))
+			continue
+		}
+		c.load(strings.TrimSuffix(filepath.Base(file), ".json"), data)
+		logger.Info("Loaded custom message catalog", zap.String("path", file))
+	}
+	return c
+}
+
+// load parses a JSON catalog and merges its templates into the locale.
+func (c *Catalog) load(locale string, data []byte) {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		c.logger.Error("Failed to parse message catalog", zap.String("locale", locale), zap.Error(err))
+		return
+	}
+
+	templates, ok := c.templates[locale]
+	if !ok {
+		templates = make(map[string]*template.Template)
+		c.templates[locale] = templates
+	}
+	for key, text := range messages {
+		tmpl, err := template.New(key).Parse(text)
+		if err != nil {
+			c.logger.Error("Failed to parse message template", zap.String("locale", locale), zap.String("key", key), zap.Error(err))
+			continue
+		}
+		templates[key] = tmpl
+	}
+}
+
+// Resolve returns the catalog locale to use for the requested one, trying the base language
+// (e.g. "pt" for "pt-BR") before the fallback.
+func (c *Catalog) Resolve(locale string) string {
+	locale = strings.ToLower(locale)
+	if _, ok := c.templates[locale]; ok {
+		return locale
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		if _, ok := c.templates[base]; ok {
+			return base
+		}
+	}
+	return c.fallback
+}
+
+// Has reports whether the catalog has messages for the locale or its base language.
+func (c *Catalog) Has(locale string) bool {
+	return c.Resolve(locale) != c.fallback || strings.EqualFold(locale, c.fallback)
+}
+
+// Locales returns the available locales in alphabetical order.
+func (c *Catalog) Locales() []string {
+	var locales []string
+	for locale := range c.templates {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Render executes the message template for the key in the given locale.
+// If the template is missing or fails, the fallback locale is tried, and finally the key itself is returned.
+func (c *Catalog) Render(locale, key string, data Data) string {
+	for _, candidate := range []string{c.Resolve(locale), c.fallback} {
+		tmpl, ok := c.templates[candidate][key]
+		if !ok {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			c.logger.Error("Failed to render message template", zap.String("locale", candidate), zap.String("key", key), zap.Error(err))
+			continue
+		}
+		return buf.String()
+	}
+	c.logger.Warn("Missing message template", zap.String("locale", locale), zap.String("key", key))
+	return key
+}
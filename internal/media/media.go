@@ -0,0 +1,162 @@
+package media
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"whatsapp-transcriber-go/internal/jsonfile"
+)
+
+// retention is how long audio metadata is kept. WhatsApp stops serving media after a while, so
+// older audio could not be downloaded anyway.
+const retention = 7 * 24 * time.Hour
+
+// Record is the stored metadata of an audio message, enough to download it later.
+type Record struct {
+	Info    types.MessageInfo `json:"info"`
+	Message []byte            `json:"message"` // Protobuf-encoded message, including the media keys
+	Time    time.Time         `json:"time"`
+}
+
+// Cache remembers recent audio messages, so they can be transcribed on demand when someone replies
+// to them, even if they were not transcribed when received.
+type Cache struct {
+	mu       sync.Mutex
+	records  map[string]Record // Records keyed by chat and message ID
+	filePath string
+	logger   *zap.Logger
+}
+
+// NewCache creates a new Cache backed by a JSON lines file.
+func NewCache(filePath string, logger *zap.Logger) *Cache {
+	c := &Cache{
+		records:  make(map[string]Record),
+		filePath: filePath,
+		logger:   logger,
+	}
+	c.load()
+	return c
+}
+
+// key builds the identifier of a message from its chat and message ID.
+func key(chat types.JID, id string) string {
+	return chat.ToNonAD().String() + "|" + id
+}
+
+// load reads the cache file, dropping expired entries, and rewrites it compacted.
+func (c *Cache) load() {
+	if err := os.MkdirAll(filepath.Dir(c.filePath), 0755); err != nil {
+		c.logger.Error("Failed to create directory for media cache file", zap.String("path", c.filePath), zap.Error(err))
+		return
+	}
+
+	file, err := os.Open(c.filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.logger.Error("Failed to open media cache file", zap.String("path", c.filePath), zap.Error(err))
+		}
+		return
+	}
+
+	cutoff := time.Now().Add(-retention)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			c.logger.Warn("Skipping invalid media cache record", zap.Error(err))
+			continue
+		}
+		if record.Time.Before(cutoff) {
+			continue
+		}
+		c.records[key(record.Info.Chat, record.Info.ID)] = record
+	}
+	if err := scanner.Err(); err != nil {
+		c.logger.Error("Error reading media cache file", zap.String("path", c.filePath), zap.Error(err))
+	}
+	file.Close()
+
+	c.compact()
+	c.logger.Info("Media cache loaded", zap.Int("count", len(c.records)))
+}
+
+// compact rewrites the cache file with only the current records.
+func (c *Cache) compact() {
+	err := jsonfile.Replace(c.filePath, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, record := range c.records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.logger.Error("Failed to compact media cache file", zap.String("path", c.filePath), zap.Error(err))
+	}
+}
+
+// appendRecord appends a single record to the cache file.
+func (c *Cache) appendRecord(record Record) {
+	if err := jsonfile.Append(c.filePath, record); err != nil {
+		c.logger.Error("Failed to write media cache record", zap.String("id", record.Info.ID), zap.Error(err))
+	}
+}
+
+// Remember stores the metadata of an audio message. Other messages are ignored.
+func (c *Cache) Remember(v *events.Message) {
+	if v.Message.GetAudioMessage() == nil {
+		return
+	}
+	// Only the audio is needed to download the media later
+	data, err := protobuf.Marshal(&proto.Message{AudioMessage: v.Message.GetAudioMessage()})
+	if err != nil {
+		c.logger.Error("Failed to marshal audio message", zap.String("id", v.Info.ID), zap.Error(err))
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key(v.Info.Chat, v.Info.ID)
+	if _, ok := c.records[k]; ok {
+		return
+	}
+	cutoff := time.Now().Add(-retention)
+	for existing, record := range c.records {
+		if record.Time.Before(cutoff) {
+			delete(c.records, existing)
+		}
+	}
+	record := Record{Info: v.Info, Message: data, Time: time.Now()}
+	c.records[k] = record
+	c.appendRecord(record)
+}
+
+// Lookup rebuilds the event of a remembered audio message.
+func (c *Cache) Lookup(chat types.JID, id string) (*events.Message, bool) {
+	c.mu.Lock()
+	record, ok := c.records[key(chat, id)]
+	c.mu.Unlock()
+	if !ok || time.Since(record.Time) > retention {
+		return nil, false
+	}
+
+	msg := &proto.Message{}
+	if err := protobuf.Unmarshal(record.Message, msg); err != nil {
+		c.logger.Error("Failed to unmarshal cached audio message", zap.String("id", id), zap.Error(err))
+		return nil, false
+	}
+	return &events.Message{Info: record.Info, Message: msg}, true
+}
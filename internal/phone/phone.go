@@ -0,0 +1,78 @@
+package phone
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxNationalLength is the longest number treated as national when written without a country code.
+// Longer numbers are assumed to already include one.
+const maxNationalLength = 11
+
+// Normalize converts a phone number as typed by a user, e.g. "+55 11 98765-4321" or "(11) 98765-4321",
+// to E.164 digits without the plus sign, e.g. "5511987654321". Numbers without an international
+// prefix that start with a trunk prefix or are no longer than a national number get
+// defaultCountryCode prepended.
+func Normalize(input, defaultCountryCode string) (string, error) {
+	input = strings.TrimSpace(input)
+	international := strings.HasPrefix(input, "+") || strings.HasPrefix(input, "00")
+
+	var digits strings.Builder
+	for _, r := range input {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case strings.ContainsRune("+-(). ", r):
+		default:
+			return "", fmt.Errorf("invalid character %q in phone number", r)
+		}
+	}
+	number := digits.String()
+
+	if international {
+		number = strings.TrimPrefix(number, "00")
+	} else if strings.HasPrefix(number, "0") || len(number) <= maxNationalLength {
+		// Drop the national trunk prefix, e.g. "(011) 98765-4321"
+		number = defaultCountryCode + strings.TrimLeft(number, "0")
+	}
+
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", fmt.Errorf("invalid phone number %q", input)
+	}
+	return number, nil
+}
+
+// FromJID validates the user part of a phone number JID, e.g. "33612345678" from
+// 33612345678@s.whatsapp.net. Unlike typed numbers, it is always in international form, so it is
+// returned unchanged rather than guessed to be national.
+func FromJID(user string) (string, error) {
+	for _, r := range user {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("invalid character %q in phone number", r)
+		}
+	}
+	if len(user) < 8 || len(user) > 15 || user[0] == '0' {
+		return "", fmt.Errorf("invalid phone number %q", user)
+	}
+	return user, nil
+}
+
+// Variants returns the normalized number and its equivalent forms. Brazilian mobile numbers may be
+// registered on WhatsApp with or without the ninth digit, so both forms are returned for them.
+func Variants(number string) []string {
+	variants := []string{number}
+	if !strings.HasPrefix(number, "55") {
+		return variants
+	}
+	switch len(number) {
+	case 13: // 55 + area code + 9 + 8 digits
+		if number[4] == '9' {
+			variants = append(variants, number[:4]+number[5:])
+		}
+	case 12: // 55 + area code + 8 digits
+		if number[4] >= '6' {
+			variants = append(variants, number[:4]+"9"+number[4:])
+		}
+	}
+	return variants
+}
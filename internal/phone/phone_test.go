@@ -0,0 +1,79 @@
+package phone
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "+55 11 98765-4321", want: "5511987654321"},
+		{input: "5511987654321", want: "5511987654321"},
+		{input: "(11) 98765-4321", want: "5511987654321"},
+		{input: "(011) 98765-4321", want: "5511987654321"},
+		{input: "0055 11 98765-4321", want: "5511987654321"},
+		{input: "+33 6 12 34 56 78", want: "33612345678"},
+		{input: "+1 202 555 0123", want: "12025550123"},
+		{input: "11 8765-4321", want: "551187654321"},
+		{input: "abc", wantErr: true},
+		{input: "123", wantErr: true},
+		{input: "+1234567890123456", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := Normalize(tt.input, "55")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Normalize(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFromJID(t *testing.T) {
+	tests := []struct {
+		user    string
+		want    string
+		wantErr bool
+	}{
+		{user: "5511987654321", want: "5511987654321"},
+		{user: "33612345678", want: "33612345678"},
+		{user: "12025550123", want: "12025550123"},
+		{user: "+33612345678", wantErr: true},
+		{user: "0612345678", wantErr: true},
+		{user: "1234", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := FromJID(tt.user)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FromJID(%q) error = %v, wantErr %v", tt.user, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("FromJID(%q) = %q, want %q", tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestVariants(t *testing.T) {
+	tests := []struct {
+		number string
+		want   []string
+	}{
+		{number: "5511987654321", want: []string{"5511987654321", "551187654321"}},
+		{number: "551187654321", want: []string{"551187654321", "5511987654321"}},
+		{number: "551132654321", want: []string{"551132654321"}},
+		{number: "33612345678", want: []string{"33612345678"}},
+		{number: "12025550123", want: []string{"12025550123"}},
+	}
+	for _, tt := range tests {
+		if got := Variants(tt.number); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Variants(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package processed
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/jsonfile"
+)
+
+// retention is how long processed message records are kept before being pruned on load.
+const retention = 30 * 24 * time.Hour
+
+// Outcome is the processing state of a message.
+type Outcome string
+
+const (
+	OutcomeProcessing Outcome = "processing"
+	OutcomeDone       Outcome = "done"
+	OutcomeFailed     Outcome = "failed"
+	OutcomeIgnored    Outcome = "ignored"
+	OutcomeCancelled  Outcome = "cancelled"
+)
+
+// Record is a processed message entry as stored on disk.
+type Record struct {
+	Key     string    `json:"key"`
+	Outcome Outcome   `json:"outcome,omitempty"` // Empty when the record was forgotten
+	Time    time.Time `json:"time"`
+}
+
+// Store remembers which messages were already processed so redelivered events are skipped.
+type Store struct {
+	mu       sync.Mutex
+	records  map[string]Record
+	filePath string
+	logger   *zap.Logger
+}
+
+// NewStore creates a new Store backed by a JSON lines file.
+func NewStore(filePath string, logger *zap.Logger) *Store {
+	s := &Store{
+		records:  make(map[string]Record),
+		filePath: filePath,
+		logger:   logger,
+	}
+	s.load()
+	return s
+}
+
+// Key builds the identifier of a message from its chat, sender and message ID.
+func Key(chat, sender, id string) string {
+	return chat + "|" + sender + "|" + id
+}
+
+// load reads the records file, dropping expired entries, and rewrites it compacted.
+func (s *Store) load() {
+	if err := os.MkdirAll(filepath.Dir(s.filePath), 0755); err != nil {
+		s.logger.Error("Failed to create directory for processed messages file", zap.String("path", s.filePath), zap.Error(err))
+		return
+	}
+
+	file, err := os.Open(s.filePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.Error("Failed to open processed messages file", zap.String("path", s.filePath), zap.Error(err))
+		}
+		return
+	}
+
+	cutoff := time.Now().Add(-retention)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			s.logger.Warn("Skipping invalid processed message record", zap.Error(err))
+			continue
+		}
+		if record.Outcome == "" || record.Time.Before(cutoff) {
+			delete(s.records, record.Key)
+			continue
+		}
+		s.records[record.Key] = record
+	}
+	if err := scanner.Err(); err != nil {
+		s.logger.Error("Error reading processed messages file", zap.String("path", s.filePath), zap.Error(err))
+	}
+	file.Close()
+
+	s.compact()
+	s.logger.Info("Processed messages loaded", zap.Int("count", len(s.records)))
+}
+
+// compact rewrites the records file with only the current records.
+func (s *Store) compact() {
+	err := jsonfile.Replace(s.filePath, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, record := range s.records {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("Failed to compact processed messages file", zap.String("path", s.filePath), zap.Error(err))
+	}
+}
+
+// appendRecord appends a single record to the records file.
+func (s *Store) appendRecord(record Record) {
+	if err := jsonfile.Append(s.filePath, record); err != nil {
+		s.logger.Error("Failed to write processed message record", zap.String("key", record.Key), zap.Error(err))
+	}
+}
+
+// Begin marks a message as being processed. It returns false if the message was seen before.
+func (s *Store) Begin(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[key]; ok {
+		return false
+	}
+	record := Record{Key: key, Outcome: OutcomeProcessing, Time: time.Now()}
+	s.records[key] = record
+	s.appendRecord(record)
+	return true
+}
+
+// Finish records the final outcome of a message.
+func (s *Store) Finish(key string, outcome Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := Record{Key: key, Outcome: outcome, Time: time.Now()}
+	s.records[key] = record
+	s.appendRecord(record)
+}
+
+// Forget removes a message so it will be processed again if delivered.
+func (s *Store) Forget(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[key]; !ok {
+		return
+	}
+	delete(s.records, key)
+	s.appendRecord(Record{Key: key, Time: time.Now()})
+}
+
+// Get returns the record of a message, if any.
+func (s *Store) Get(key string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[key]
+	return record, ok
+}
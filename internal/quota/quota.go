@@ -0,0 +1,200 @@
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/jsonfile"
+)
+
+// Period is the span a limit applies to.
+type Period string
+
+const (
+	Daily   Period = "daily"
+	Monthly Period = "monthly"
+)
+
+// Limits are the seconds of audio that may be transcribed per period. Zero means no limit.
+type Limits struct {
+	Daily   int
+	Monthly int
+}
+
+// Usage is the transcribed audio of a sender or chat as stored on disk.
+type Usage struct {
+	Day          string `json:"day"`             // Day the daily seconds were counted on, as YYYY-MM-DD
+	DaySeconds   int    `json:"day_seconds"`     // Seconds transcribed on Day
+	Month        string `json:"month"`           // Month the monthly seconds were counted in, as YYYY-MM
+	MonthSeconds int    `json:"month_seconds"`   // Seconds transcribed in Month
+	Extra        int    `json:"extra,omitempty"` // Seconds granted on top of the limits, used once they are reached
+}
+
+// current returns the usage with the counters of past days and months reset.
+func (u Usage) current(now time.Time) Usage {
+	if day := now.Format("2006-01-02"); u.Day != day {
+		u.Day, u.DaySeconds = day, 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month, u.MonthSeconds = month, 0
+	}
+	return u
+}
+
+// exceeded returns the period whose limit seconds more of audio would exceed, empty if it fits.
+func (u Usage) exceeded(limits Limits, seconds int) Period {
+	if limits.Daily > 0 && u.DaySeconds+seconds > limits.Daily {
+		return Daily
+	}
+	if limits.Monthly > 0 && u.MonthSeconds+seconds > limits.Monthly {
+		return Monthly
+	}
+	return ""
+}
+
+// Reset returns how long until the limit of a period starts over.
+func Reset(period Period, now time.Time) time.Duration {
+	year, month, day := now.Date()
+	next := time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	if period == Monthly {
+		next = time.Date(year, month+1, 1, 0, 0, 0, 0, now.Location())
+	}
+	return next.Sub(now)
+}
+
+// Store tracks how many seconds of audio each sender and chat had transcribed, so the provider is
+// only called while they are within their quota.
+type Store struct {
+	mu       sync.Mutex
+	usage    map[string]Usage
+	filePath string
+	logger   *zap.Logger
+}
+
+// NewStore creates a new Store backed by a JSON file.
+func NewStore(filePath string, logger *zap.Logger) *Store {
+	s := &Store{
+		usage:    make(map[string]Usage),
+		filePath: filePath,
+		logger:   logger,
+	}
+	s.load()
+	return s
+}
+
+// load reads the quota file into memory.
+func (s *Store) load() {
+	found, err := jsonfile.Load(s.filePath, &s.usage)
+	if err != nil {
+		s.logger.Error("Failed to load quota file", zap.String("path", s.filePath), zap.Error(err))
+		return
+	}
+	if found {
+		s.logger.Info("Quota usage loaded", zap.Int("count", len(s.usage)))
+	}
+}
+
+// save writes the usage over the quota file.
+func (s *Store) save() {
+	if err := jsonfile.Save(s.filePath, s.usage); err != nil {
+		s.logger.Error("Failed to save quota file", zap.String("path", s.filePath), zap.Error(err))
+	}
+}
+
+// find returns the key the usage of a sender or chat is stored under, trying each of its keys, and
+// the usage with past periods reset. Unknown senders and chats are stored under the first key, and
+// without keys the key is empty. The caller must hold s.mu.
+func (s *Store) find(keys []string) (string, Usage) {
+	now := time.Now()
+	for _, key := range keys {
+		if usage, ok := s.usage[key]; ok {
+			return key, usage.current(now)
+		}
+	}
+	if len(keys) == 0 {
+		return "", Usage{}.current(now)
+	}
+	return keys[0], Usage{}.current(now)
+}
+
+// Get returns the current usage of a sender or chat, trying each of its keys.
+func (s *Store) Get(keys ...string) Usage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, usage := s.find(keys)
+	return usage
+}
+
+// Reservation is audio counted against a quota before it is transcribed, so it can be refunded if
+// transcription fails.
+type Reservation struct {
+	key     string
+	day     string
+	month   string
+	seconds int
+	extra   int // Granted extra seconds taken by the reservation
+}
+
+// Reserve counts seconds of audio against the quota of a sender or chat, if they fit within the limits
+// or the granted extra seconds. Checking and counting happen at once, so concurrent transcriptions
+// can't together exceed the quota. Audio that does not fit within the limits is taken from the extra
+// seconds. It returns the period whose limit would be exceeded, or empty if the seconds were reserved.
+// Without keys, nothing is counted.
+func (s *Store) Reserve(limits Limits, seconds int, keys ...string) (Reservation, Period) {
+	if len(keys) == 0 {
+		return Reservation{}, ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, usage := s.find(keys)
+	reservation := Reservation{key: key, day: usage.Day, month: usage.Month, seconds: seconds}
+	if period := usage.exceeded(limits, seconds); period != "" {
+		if usage.Extra < seconds {
+			return Reservation{}, period
+		}
+		usage.Extra -= seconds
+		reservation.extra = seconds
+	}
+	usage.DaySeconds += seconds
+	usage.MonthSeconds += seconds
+	s.usage[key] = usage
+	s.save()
+	return reservation, ""
+}
+
+// Refund gives back the seconds of a reservation, for audio that could not be transcribed. Seconds
+// of a day or month that is already over are not refunded, since their count was reset.
+func (s *Store) Refund(reservation Reservation) {
+	if reservation.key == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.usage[reservation.key].current(time.Now())
+	if usage.Day == reservation.day {
+		usage.DaySeconds = max(usage.DaySeconds-reservation.seconds, 0)
+	}
+	if usage.Month == reservation.month {
+		usage.MonthSeconds = max(usage.MonthSeconds-reservation.seconds, 0)
+	}
+	usage.Extra += reservation.extra
+	s.usage[reservation.key] = usage
+	s.save()
+}
+
+// Grant adds extra seconds to a sender's or chat's quota and returns their total extra seconds.
+func (s *Store) Grant(seconds int, keys ...string) int {
+	if len(keys) == 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, usage := s.find(keys)
+	usage.Extra += seconds
+	s.usage[key] = usage
+	s.save()
+	s.logger.Info("Quota granted", zap.String("key", key), zap.Int("seconds", seconds), zap.Int("extra", usage.Extra))
+	return usage.Extra
+}
@@ -0,0 +1,79 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestReserve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+	s := NewStore(path, zap.NewNop())
+	limits := Limits{Daily: 100, Monthly: 150}
+
+	if _, period := s.Reserve(limits, 60, "5511987654321", "551187654321"); period != "" {
+		t.Fatalf("Reserve within the limits failed: %q", period)
+	}
+	// The usage is found under any of the sender's keys
+	if _, period := s.Reserve(limits, 60, "551187654321", "5511987654321"); period != Daily {
+		t.Errorf("Reserve over the daily limit = %q, want %q", period, Daily)
+	}
+	if got := s.Get("551187654321", "5511987654321"); got.DaySeconds != 60 || got.MonthSeconds != 60 {
+		t.Errorf("Usage after a refused reservation = %+v, want 60 seconds", got)
+	}
+
+	// Granted seconds are used once the limits are reached
+	if extra := s.Grant(50, "5511987654321"); extra != 50 {
+		t.Errorf("Grant returned %d extra seconds, want 50", extra)
+	}
+	reservation, period := s.Reserve(limits, 50, "5511987654321")
+	if period != "" {
+		t.Fatalf("Reserve with granted seconds failed: %q", period)
+	}
+	if got := s.Get("5511987654321"); got.Extra != 0 || got.DaySeconds != 110 {
+		t.Errorf("Usage after using granted seconds = %+v, want 110 seconds and no extra", got)
+	}
+
+	// Refunds give back the seconds and the granted seconds they took
+	s.Refund(reservation)
+	if got := s.Get("5511987654321"); got.Extra != 50 || got.DaySeconds != 60 {
+		t.Errorf("Usage after refund = %+v, want 60 seconds and 50 extra", got)
+	}
+
+	// Usage is kept across restarts
+	if got := NewStore(path, zap.NewNop()).Get("5511987654321"); got.DaySeconds != 60 || got.Extra != 50 {
+		t.Errorf("Usage after reload = %+v, want 60 seconds and 50 extra", got)
+	}
+}
+
+func TestReserveMonthly(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "quota.json"), zap.NewNop())
+	s.usage["chat"] = Usage{Month: time.Now().Format("2006-01"), MonthSeconds: 140}
+	if _, period := s.Reserve(Limits{Daily: 100, Monthly: 150}, 20, "chat"); period != Monthly {
+		t.Errorf("Reserve over the monthly limit = %q, want %q", period, Monthly)
+	}
+}
+
+func TestReserveWithoutKeys(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "quota.json"), zap.NewNop())
+	reservation, period := s.Reserve(Limits{Daily: 10}, 60)
+	if period != "" {
+		t.Errorf("Reserve without keys = %q, want no limit", period)
+	}
+	s.Refund(reservation)
+	if len(s.usage) != 0 {
+		t.Errorf("Usage without keys was stored: %v", s.usage)
+	}
+}
+
+func TestRefundAfterDayChange(t *testing.T) {
+	s := NewStore(filepath.Join(t.TempDir(), "quota.json"), zap.NewNop())
+	reservation, _ := s.Reserve(Limits{}, 30, "sender")
+	reservation.day = "2000-01-01" // Reserved on a day that is over
+	s.Refund(reservation)
+	if got := s.Get("sender"); got.DaySeconds != 30 || got.MonthSeconds != 0 {
+		t.Errorf("Usage after refunding a past day's reservation = %+v, want 30 daily and 0 monthly seconds", got)
+	}
+}
@@ -0,0 +1,166 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// vipBonus is the number of seconds subtracted from the estimated duration of VIP jobs,
+// which puts them ahead of any regular voice note of less than an hour.
+const vipBonus = 3600
+
+// Priority describes how urgently a job should run.
+type Priority struct {
+	Seconds int  // Estimated audio duration in seconds
+	VIP     bool // Whether the job belongs to an admin or VIP contact
+}
+
+// Scheduler is a bounded worker pool that hands out slots to the shortest waiting job first.
+// To keep long jobs from starving, every second spent waiting lowers a job's effective
+// duration by the aging rate.
+type Scheduler struct {
+	mu        sync.Mutex
+	free      int
+	queue     waitQueue
+	agingRate float64
+	start     time.Time
+	seq       uint64
+	logger    *zap.Logger
+}
+
+// NewScheduler creates a Scheduler that runs at most size jobs concurrently.
+func NewScheduler(size int, agingRate float64, logger *zap.Logger) *Scheduler {
+	if size < 1 {
+		size = 1
+	}
+	return &Scheduler{
+		free:      size,
+		agingRate: agingRate,
+		start:     time.Now(),
+		logger:    logger,
+	}
+}
+
+// Acquire blocks until a slot is available for a job with the given priority or ctx is done.
+// The returned release function must be called when the job finishes.
+func (s *Scheduler) Acquire(ctx context.Context, p Priority) (func(), error) {
+	s.mu.Lock()
+	if s.free > 0 && s.queue.Len() == 0 {
+		s.free--
+		s.mu.Unlock()
+		return s.releaseFunc(), nil
+	}
+
+	w := &waiter{
+		key:   s.key(p),
+		seq:   s.seq,
+		ready: make(chan struct{}),
+	}
+	s.seq++
+	heap.Push(&s.queue, w)
+	queued := s.queue.Len()
+	s.mu.Unlock()
+
+	s.logger.Debug("Job queued", zap.Int("seconds", p.Seconds), zap.Bool("vip", p.VIP), zap.Int("queued", queued))
+
+	select {
+	case <-w.ready:
+		return s.releaseFunc(), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		granted := w.index < 0
+		if !granted {
+			heap.Remove(&s.queue, w.index)
+		}
+		s.mu.Unlock()
+		if granted {
+			// The slot was handed over while we were giving up, pass it on.
+			s.release()
+		}
+		return nil, fmt.Errorf("waiting for worker slot: %w", ctx.Err())
+	}
+}
+
+// Queued returns the number of jobs waiting for a slot.
+func (s *Scheduler) Queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queue.Len()
+}
+
+// key computes the static ordering key of a job enqueued now; lower keys run first.
+// Aging lowers every waiting job's effective duration at the same rate, so ordering by
+// duration plus scaled enqueue time is equivalent to ordering by the aged duration.
+func (s *Scheduler) key(p Priority) float64 {
+	key := float64(p.Seconds) + s.agingRate*time.Since(s.start).Seconds()
+	if p.VIP {
+		key -= vipBonus
+	}
+	return key
+}
+
+func (s *Scheduler) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(s.release)
+	}
+}
+
+// release hands the slot to the next waiting job or returns it to the pool.
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue.Len() > 0 {
+		w := heap.Pop(&s.queue).(*waiter)
+		close(w.ready)
+		return
+	}
+	s.free++
+}
+
+// waiter is a job waiting for a slot.
+type waiter struct {
+	key   float64
+	seq   uint64 // Tie-breaker keeping equal keys in arrival order
+	ready chan struct{}
+	index int // Position in the heap, -1 once popped
+}
+
+// waitQueue implements heap.Interface ordered by key.
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].key != q[j].key {
+		return q[i].key < q[j].key
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *waitQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *waitQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	w.index = -1
+	*q = old[:n-1]
+	return w
+}
@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// runOrder queues jobs behind a single busy slot, one at a time, and returns the order they ran in.
+func runOrder(t *testing.T, s *Scheduler, jobs []Priority) []int {
+	t.Helper()
+	release, err := s.Acquire(context.Background(), Priority{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i, p := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background(), p)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			release()
+		}()
+		// Wait for the job to be queued, so jobs are enqueued in order
+		for s.Queued() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	release()
+	wg.Wait()
+	return order
+}
+
+func TestShortestFirst(t *testing.T) {
+	s := NewScheduler(1, 0, zap.NewNop())
+	order := runOrder(t, s, []Priority{{Seconds: 300}, {Seconds: 10}, {Seconds: 60}, {Seconds: 10}})
+	if want := []int{1, 3, 2, 0}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Jobs ran in order %v, want %v", order, want)
+	}
+}
+
+func TestVIPFirst(t *testing.T) {
+	s := NewScheduler(1, 0, zap.NewNop())
+	order := runOrder(t, s, []Priority{{Seconds: 10}, {Seconds: 600, VIP: true}, {Seconds: 5}})
+	if want := []int{1, 2, 0}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Jobs ran in order %v, want %v", order, want)
+	}
+}
+
+func TestAging(t *testing.T) {
+	s := NewScheduler(1, 1, zap.NewNop())
+	long := s.key(Priority{Seconds: 120})
+	// After waiting 200 seconds, the long job goes before a shorter job enqueued now, but not before a VIP
+	s.start = s.start.Add(-200 * time.Second)
+	if short := s.key(Priority{Seconds: 10}); short <= long {
+		t.Errorf("Key of a later short job = %v, want it above the waiting long job's %v", short, long)
+	}
+	if vip := s.key(Priority{Seconds: 10, VIP: true}); vip >= long {
+		t.Errorf("Key of a later VIP job = %v, want it below the waiting long job's %v", vip, long)
+	}
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	s := NewScheduler(1, 0, zap.NewNop())
+	release, err := s.Acquire(context.Background(), Priority{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Acquire(ctx, Priority{Seconds: 10}); err == nil {
+		t.Error("Acquire succeeded while the only slot was taken")
+	}
+	if s.Queued() != 0 {
+		t.Errorf("Queued() = %d after the waiting job gave up, want 0", s.Queued())
+	}
+	release()
+	if _, err := s.Acquire(context.Background(), Priority{}); err != nil {
+		t.Errorf("Acquire after release failed: %v", err)
+	}
+}
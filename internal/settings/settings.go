@@ -0,0 +1,123 @@
+package settings
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/jsonfile"
+)
+
+// Settings holds per-chat or per-contact overrides. Empty fields fall back to the global configuration.
+type Settings struct {
+	Reactions   *bool  `json:"reactions,omitempty"`    // React to audio with progress emojis
+	Presence    *bool  `json:"presence,omitempty"`     // Show "typing..." while transcribing
+	Locale      string `json:"locale,omitempty"`       // Locale of bot-generated messages
+	Enabled     *bool  `json:"enabled,omitempty"`      // Transcribe audio in the chat; groups are opt-in
+	Style       string `json:"style,omitempty"`        // Formatting of transcripts
+	Language    string `json:"language,omitempty"`     // Language of the audio, "auto" to detect it
+	Translate   string `json:"translate,omitempty"`    // Language to translate transcripts into, "off" for none
+	Provider    string `json:"provider,omitempty"`     // Transcription provider
+	MaxDuration int    `json:"max_duration,omitempty"` // Longest audio to transcribe in seconds, -1 for no limit
+}
+
+// Merge returns the settings with the fields set in override replacing their own, so settings can be
+// layered, e.g. chat settings overridden by the sender's.
+func (s Settings) Merge(override Settings) Settings {
+	if override.Reactions != nil {
+		s.Reactions = override.Reactions
+	}
+	if override.Presence != nil {
+		s.Presence = override.Presence
+	}
+	if override.Locale != "" {
+		s.Locale = override.Locale
+	}
+	if override.Enabled != nil {
+		s.Enabled = override.Enabled
+	}
+	if override.Style != "" {
+		s.Style = override.Style
+	}
+	if override.Language != "" {
+		s.Language = override.Language
+	}
+	if override.Translate != "" {
+		s.Translate = override.Translate
+	}
+	if override.Provider != "" {
+		s.Provider = override.Provider
+	}
+	if override.MaxDuration != 0 {
+		s.MaxDuration = override.MaxDuration
+	}
+	return s
+}
+
+// Store persists settings keyed by chat JID.
+type Store struct {
+	mu       sync.RWMutex
+	settings map[string]Settings
+	filePath string
+	logger   *zap.Logger
+}
+
+// NewStore creates a new Store backed by a JSON file.
+func NewStore(filePath string, logger *zap.Logger) *Store {
+	s := &Store{
+		settings: make(map[string]Settings),
+		filePath: filePath,
+		logger:   logger,
+	}
+	s.load()
+	return s
+}
+
+// load reads the settings file into memory.
+func (s *Store) load() {
+	found, err := jsonfile.Load(s.filePath, &s.settings)
+	if err != nil {
+		s.logger.Error("Failed to load settings file", zap.String("path", s.filePath), zap.Error(err))
+		return
+	}
+	if found {
+		s.logger.Info("Settings loaded", zap.Int("count", len(s.settings)))
+	}
+}
+
+// save writes the settings over the settings file.
+func (s *Store) save() {
+	if err := jsonfile.Save(s.filePath, s.settings); err != nil {
+		s.logger.Error("Failed to save settings file", zap.String("path", s.filePath), zap.Error(err))
+	}
+}
+
+// Get returns the settings of a JID. Unset JIDs get empty settings.
+func (s *Store) Get(jid string) Settings {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.settings[jid]
+}
+
+// Update applies fn to the settings of a JID and persists the result.
+func (s *Store) Update(jid string, fn func(*Settings)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	settings := s.settings[jid]
+	fn(&settings)
+	if settings == (Settings{}) {
+		delete(s.settings, jid)
+	} else {
+		s.settings[jid] = settings
+	}
+	s.save()
+	s.logger.Info("Settings updated", zap.String("jid", jid))
+}
+
+// Bool resolves an optional setting against its default.
+func Bool(value *bool, def bool) bool {
+	if value == nil {
+		return def
+	}
+	return *value
+}
@@ -0,0 +1,40 @@
+package transcription
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// splitAudio cuts an audio file into chunks of the given length with ffmpeg, without re-encoding.
+// The chunks are written to a new directory inside dir, which the caller must remove.
+func splitAudio(ctx context.Context, audioFilePath, dir string, seconds int) (string, []string, error) {
+	chunkDir, err := os.MkdirTemp(dir, "chunks-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create chunk directory: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error",
+		"-i", audioFilePath,
+		"-f", "segment",
+		"-segment_time", strconv.Itoa(seconds),
+		"-reset_timestamps", "1",
+		"-c", "copy",
+		filepath.Join(chunkDir, "chunk-%03d.ogg"),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(chunkDir)
+		return "", nil, fmt.Errorf("ffmpeg failed: %w, output: %s", err, output)
+	}
+
+	chunks, err := filepath.Glob(filepath.Join(chunkDir, "chunk-*.ogg"))
+	if err != nil || len(chunks) == 0 {
+		os.RemoveAll(chunkDir)
+		return "", nil, fmt.Errorf("ffmpeg produced no chunks")
+	}
+	return chunkDir, chunks, nil
+}
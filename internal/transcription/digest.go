@@ -0,0 +1,166 @@
+package transcription
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
+	"go.uber.org/zap"
+
+	"whatsapp-transcriber-go/internal/locale"
+)
+
+// DigestEntry is a single transcript collected into a digest.
+type DigestEntry struct {
+	Sender    string
+	Timestamp time.Time
+	Text      string
+	Failed    bool
+}
+
+// digestChat holds the collected entries of a chat and how many jobs are still expected.
+type digestChat struct {
+	pending int
+	entries []DigestEntry
+}
+
+// Digest batches transcripts of audio received while the bot was offline into a digest per chat.
+// A chat's digest is sent once all of its expected jobs are done and the offline sync has completed.
+type Digest struct {
+	Client    *whatsmeow.Client
+	Logger    *zap.Logger
+	Catalog   *locale.Catalog
+	Locale    func(chat types.JID) string // Resolves the locale of a chat's digest
+	Style     Style
+	MaxLength int // Digests longer than this many characters are sent as several messages, zero for no limit
+
+	mu      sync.Mutex
+	chats   map[types.JID]*digestChat
+	syncing bool
+}
+
+// NewDigest creates a new Digest.
+func NewDigest(cli *whatsmeow.Client, catalog *locale.Catalog, localeFor func(chat types.JID) string, logger *zap.Logger) *Digest {
+	return &Digest{
+		Client:  cli,
+		Logger:  logger,
+		Catalog: catalog,
+		Locale:  localeFor,
+		Style:   StyleItalic,
+		chats:   make(map[types.JID]*digestChat),
+	}
+}
+
+// Expect registers a job whose transcript will be delivered to the chat's digest.
+func (d *Digest) Expect(chat types.JID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	c, ok := d.chats[chat]
+	if !ok {
+		c = &digestChat{}
+		d.chats[chat] = c
+	}
+	c.pending++
+}
+
+// Deliver adds a transcript to the chat's digest.
+func (d *Digest) Deliver(chat types.JID, entry DigestEntry) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.chats[chat]; ok {
+		c.entries = append(c.entries, entry)
+	}
+}
+
+// Done marks an expected job as finished and sends the digest if it was the last one.
+func (d *Digest) Done(chat types.JID) {
+	d.mu.Lock()
+	c, ok := d.chats[chat]
+	if !ok {
+		d.mu.Unlock()
+		return
+	}
+	c.pending--
+	if c.pending > 0 || d.syncing {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.chats, chat)
+	d.mu.Unlock()
+
+	d.send(chat, c.entries)
+}
+
+// SetSyncing marks whether the offline sync is in progress. Digests are held back while it is,
+// and any complete digests are sent once it finishes.
+func (d *Digest) SetSyncing(syncing bool) {
+	d.mu.Lock()
+	d.syncing = syncing
+	ready := make(map[types.JID][]DigestEntry)
+	if !syncing {
+		for chat, c := range d.chats {
+			if c.pending <= 0 {
+				ready[chat] = c.entries
+				delete(d.chats, chat)
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	for chat, entries := range ready {
+		d.send(chat, entries)
+	}
+}
+
+// send replies with the collected transcripts of a chat, in as few messages of at most MaxLength
+// characters as possible. Transcripts too long for a message are split like regular replies.
+func (d *Digest) send(chat types.JID, entries []DigestEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	lang := d.Locale(chat)
+	blocks := []string{d.Catalog.Render(lang, "digest.header", nil)}
+	failed := 0
+	for _, entry := range entries {
+		if entry.Failed {
+			failed++
+			continue
+		}
+		header := d.Catalog.Render(lang, "digest.entry", locale.Data{
+			"Time":   entry.Timestamp.Local().Format("02/01 15:04"),
+			"Sender": entry.Sender,
+		})
+		for _, part := range SplitTranscript(entry.Text, d.MaxLength) {
+			blocks = append(blocks, composeTranscript(header, part, d.Style))
+		}
+	}
+	if failed > 0 {
+		blocks = append(blocks, d.Catalog.Render(lang, "digest.failed", locale.Data{"Count": failed}))
+	}
+
+	var messages []string
+	for _, block := range blocks {
+		last := len(messages) - 1
+		if last >= 0 && (d.MaxLength <= 0 || utf8.RuneCountInString(messages[last])+2+utf8.RuneCountInString(block) <= d.MaxLength) {
+			messages[last] += "\n\n" + block
+			continue
+		}
+		messages = append(messages, block)
+	}
+
+	for _, text := range messages {
+		_, err := d.Client.SendMessage(context.Background(), chat, &proto.Message{
+			Conversation: &text,
+		})
+		if err != nil {
+			d.Logger.Error("Failed to send digest message", zap.Error(err), zap.String("to", chat.String()))
+			return
+		}
+	}
+	d.Logger.Info("Sent offline digest", zap.String("to", chat.String()), zap.Int("entries", len(entries)), zap.Int("messages", len(messages)))
+}
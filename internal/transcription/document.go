@@ -0,0 +1,58 @@
+package transcription
+
+import (
+	"context"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/binary/proto"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// previewLength is the number of runes of a transcript shown in the message accompanying a document.
+const previewLength = 300
+
+// replyWithDocument sends the transcript as a document attachment followed by a short preview message.
+func (j *Job) replyWithDocument(ctx context.Context, text string) error {
+	content, mimeType, extension := text+"\n", "text/plain", "txt"
+	if j.DocumentFormat == "md" {
+		content = fmt.Sprintf("# %s\n\n%s\n", j.text("transcript.document_title", nil), text)
+		mimeType, extension = "text/markdown", "md"
+	}
+
+	uploaded, err := j.Client.Upload(ctx, []byte(content), whatsmeow.MediaDocument)
+	if err != nil {
+		return fmt.Errorf("failed to upload transcript document: %w", err)
+	}
+
+	fileName := fmt.Sprintf("%s-%s.%s", j.text("transcript.document_name", nil), j.Message.Info.ID, extension)
+	reply := j.quotedReply("")
+	document := &proto.Message{
+		DocumentMessage: &proto.DocumentMessage{
+			URL:           &uploaded.URL,
+			DirectPath:    &uploaded.DirectPath,
+			MediaKey:      uploaded.MediaKey,
+			FileEncSHA256: uploaded.FileEncSHA256,
+			FileSHA256:    uploaded.FileSHA256,
+			FileLength:    protobuf.Uint64(uploaded.FileLength),
+			Mimetype:      &mimeType,
+			FileName:      &fileName,
+			Title:         &fileName,
+			ContextInfo:   reply.GetExtendedTextMessage().GetContextInfo(),
+		},
+	}
+	if _, err := j.Client.SendMessage(ctx, j.Message.Info.Chat, document); err != nil {
+		return fmt.Errorf("failed to send transcript document: %w", err)
+	}
+
+	preview := []rune(text)
+	if len(preview) > previewLength {
+		preview = append(preview[:previewLength], '…')
+	}
+	message := composeTranscript(j.prefix(0, 0), string(preview), j.Style) + "\n\n" + j.text("transcript.document_note", nil)
+	if _, err := j.Client.SendMessage(ctx, j.Message.Info.Chat, j.quotedReply(message)); err != nil {
+		j.Logger.Error("Failed to send transcript preview", zap.Error(err), zap.String("to", j.Message.Info.Chat.String()))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package transcription
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.uber.org/zap"
+)
+
+// Reactions shown on the original audio while it is being processed.
+const (
+	reactionWorking = "⏳"
+	reactionDone    = "✅"
+	reactionFailed  = "❌"
+)
+
+// presenceInterval is how often the composing presence is refreshed, since WhatsApp clears it after a while.
+const presenceInterval = 10 * time.Second
+
+// react sets the bot's reaction on the original audio message.
+func (j *Job) react(ctx context.Context, reaction string) {
+	if !j.Reactions {
+		return
+	}
+	msg := j.Client.BuildReaction(j.Message.Info.Chat, j.Message.Info.Sender, j.Message.Info.ID, reaction)
+	if _, err := j.Client.SendMessage(ctx, j.Message.Info.Chat, msg); err != nil {
+		j.Logger.Error("Failed to send reaction", zap.Error(err), zap.String("to", j.Message.Info.Chat.String()))
+	}
+}
+
+// showComposing sends the "composing" chat presence until the returned function is called.
+func (j *Job) showComposing() func() {
+	if !j.Presence {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(presenceInterval)
+		defer ticker.Stop()
+		for {
+			if err := j.Client.SendChatPresence(j.Message.Info.Chat, types.ChatPresenceComposing, types.ChatPresenceMediaText); err != nil {
+				j.Logger.Debug("Failed to send composing presence", zap.Error(err))
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		if err := j.Client.SendChatPresence(j.Message.Info.Chat, types.ChatPresencePaused, types.ChatPresenceMediaText); err != nil {
+			j.Logger.Debug("Failed to send paused presence", zap.Error(err))
+		}
+	}
+}
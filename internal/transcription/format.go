@@ -0,0 +1,76 @@
+package transcription
+
+import (
+	"strings"
+)
+
+// Style is the way transcripts are formatted in WhatsApp messages.
+type Style string
+
+const (
+	StyleItalic    Style = "italic"    // Each line wrapped in _..._
+	StylePlain     Style = "plain"     // No formatting
+	StyleQuote     Style = "quote"     // Each line prefixed with "> "
+	StyleMonospace Style = "monospace" // Wrapped in a ``` block
+)
+
+// ParseStyle returns the style with the given name, and false if the name is unknown.
+func ParseStyle(name string) (Style, bool) {
+	switch style := Style(strings.ToLower(name)); style {
+	case StyleItalic, StylePlain, StyleQuote, StyleMonospace:
+		return style, true
+	}
+	return StyleItalic, false
+}
+
+// markupReplacer neutralises WhatsApp markup characters by replacing them with lookalikes,
+// since WhatsApp has no escape character.
+var markupReplacer = strings.NewReplacer(
+	"*", "∗", // Asterisk operator
+	"_", "＿", // Fullwidth low line
+	"~", "∼", // Tilde operator
+	"`", "ˋ", // Modifier letter grave accent
+)
+
+// EscapeMarkup replaces characters that WhatsApp interprets as formatting.
+func EscapeMarkup(text string) string {
+	return markupReplacer.Replace(text)
+}
+
+// FormatTranscript escapes the transcript and applies the style. Line-based styles are applied to
+// every non-empty line, since WhatsApp formatting does not cross newlines.
+func FormatTranscript(text string, style Style) string {
+	text = EscapeMarkup(strings.TrimSpace(text))
+
+	switch style {
+	case StylePlain:
+		return text
+	case StyleMonospace:
+		return "```" + text + "```"
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			lines[i] = ""
+			continue
+		}
+		if style == StyleQuote {
+			lines[i] = "> " + line
+		} else {
+			lines[i] = "_" + line + "_"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// composeTranscript joins a header and a transcript formatted in the given style. The transcript
+// starts on the header's line when it is a single italic or plain line, and on its own line otherwise.
+func composeTranscript(header, text string, style Style) string {
+	body := FormatTranscript(text, style)
+	if (style == StyleItalic || style == StylePlain) && !strings.Contains(body, "\n") {
+		return header + " " + body
+	}
+	return header + "\n" + body
+}
@@ -16,6 +16,7 @@ import (
 )
 
 const groqAPIURL = "https://api.groq.com/openai/v1/audio/transcriptions"
+const groqTranslationURL = "https://api.groq.com/openai/v1/audio/translations"
 
 // GroqTranscriber implements the Transcriber interface for Groq API.
 type GroqTranscriber struct {
@@ -35,6 +36,16 @@ func NewGroqTranscriber(apiKey, model string, logger *zap.Logger) *GroqTranscrib
 
 // TranscribeAudio sends an audio file to Groq API for transcription.
 func (g *GroqTranscriber) TranscribeAudio(ctx context.Context, audioFilePath string, language string) (string, error) {
+	return g.send(ctx, groqAPIURL, audioFilePath, language)
+}
+
+// TranslateAudio sends an audio file to Groq API for translation into English.
+func (g *GroqTranscriber) TranslateAudio(ctx context.Context, audioFilePath string) (string, error) {
+	return g.send(ctx, groqTranslationURL, audioFilePath, "")
+}
+
+// send posts an audio file to a Groq audio endpoint and returns the resulting text.
+func (g *GroqTranscriber) send(ctx context.Context, apiURL string, audioFilePath string, language string) (string, error) {
 	file, err := os.Open(audioFilePath)
 	if err != nil {
 		return "", fmt.Errorf("failed to open audio file: %w", err)
@@ -62,7 +73,7 @@ func (g *GroqTranscriber) TranscribeAudio(ctx context.Context, audioFilePath str
 	}
 	writer.Close() // Close the multipart writer to write the trailing boundary
 
-	req, err := http.NewRequestWithContext(ctx, "POST", groqAPIURL, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiURL, body)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -0,0 +1,84 @@
+package transcription
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.uber.org/zap"
+)
+
+// Message keys of the markers appended to progressively delivered transcripts.
+const (
+	markerInProgress = "progress.in_progress"
+	markerContinued  = "progress.continued"
+	markerComplete   = "progress.complete"
+	markerIncomplete = "progress.incomplete"
+)
+
+// progressiveReply delivers a transcript chunk by chunk, editing the sent message as chunks complete.
+// When the text outgrows the job's maximum length, a new message is started.
+type progressiveReply struct {
+	job   *Job
+	index int             // Number of messages completed before the current one
+	id    types.MessageID // ID of the message currently being edited, empty before the first send
+	text  string          // Text of the message currently being edited
+}
+
+// add appends a transcribed chunk and updates the current message.
+func (p *progressiveReply) add(ctx context.Context, chunk string) {
+	chunk = strings.TrimSpace(chunk)
+	if chunk == "" {
+		return
+	}
+
+	if p.id != "" && p.job.MaxLength > 0 && utf8.RuneCountInString(p.text)+1+utf8.RuneCountInString(chunk) > p.job.MaxLength {
+		p.send(ctx, markerContinued)
+		p.index++
+		p.id, p.text = "", ""
+	}
+	if p.text != "" {
+		p.text += " "
+	}
+	p.text += chunk
+	p.send(ctx, markerInProgress)
+}
+
+// finish marks the current message as complete, or incomplete if the transcription failed. If no
+// speech was found in any chunk, it says so instead.
+func (p *progressiveReply) finish(ctx context.Context, complete bool) {
+	if p.id == "" {
+		if complete {
+			p.text = p.job.text("transcript.empty", nil)
+			p.send(ctx, markerComplete)
+		}
+		return
+	}
+	if complete {
+		p.send(ctx, markerComplete)
+	} else {
+		p.send(ctx, markerIncomplete)
+	}
+}
+
+// send sends the current message, or edits it if it was already sent.
+func (p *progressiveReply) send(ctx context.Context, marker string) {
+	prefix := p.job.prefix(0, 0)
+	if p.index > 0 {
+		prefix += " _" + p.job.text("transcript.continued", nil) + "_"
+	}
+	msg := p.job.quotedReply(composeTranscript(prefix, p.text, p.job.Style) + "\n\n" + p.job.text(marker, nil))
+
+	if p.id != "" {
+		msg = p.job.Client.BuildEdit(p.job.Message.Info.Chat, p.id, msg)
+	}
+	resp, err := p.job.Client.SendMessage(ctx, p.job.Message.Info.Chat, msg)
+	if err != nil {
+		p.job.Logger.Error("Failed to send progressive transcript", zap.Error(err), zap.String("to", p.job.Message.Info.Chat.String()))
+		return
+	}
+	if p.id == "" {
+		p.id = resp.ID
+	}
+}
@@ -0,0 +1,54 @@
+package transcription
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitTranscript splits text into parts of at most limit runes, preferring to break after a
+// sentence, then at a line or word boundary. A limit of zero or less returns the text as one part, and
+// so does empty text, so callers always have a part to send.
+func SplitTranscript(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if limit <= 0 || text == "" {
+		return []string{text}
+	}
+
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > limit {
+		cut := splitPoint(runes[:limit+1])
+		if part := strings.TrimSpace(string(runes[:cut])); part != "" {
+			parts = append(parts, part)
+		}
+		runes = []rune(strings.TrimLeftFunc(string(runes[cut:]), unicode.IsSpace))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+	return parts
+}
+
+// splitPoint returns where to cut window, which holds one rune more than the limit so a boundary
+// right after the limit is seen. Boundaries in the first half are ignored to avoid tiny parts.
+func splitPoint(window []rune) int {
+	limit := len(window) - 1
+	min := limit / 2
+
+	for i := limit - 1; i >= min; i-- {
+		if strings.ContainsRune(".!?…", window[i]) && unicode.IsSpace(window[i+1]) {
+			return i + 1
+		}
+	}
+	for i := limit; i >= min; i-- {
+		if window[i] == '\n' {
+			return i
+		}
+	}
+	for i := limit; i >= min; i-- {
+		if unicode.IsSpace(window[i]) {
+			return i
+		}
+	}
+	return limit
+}
@@ -0,0 +1,82 @@
+package transcription
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTranscript(t *testing.T) {
+	tests := []struct {
+		text  string
+		limit int
+		want  []string
+	}{
+		{text: "Short text.", limit: 100, want: []string{"Short text."}},
+		{text: "  Padded.  ", limit: 0, want: []string{"Padded."}},
+		{text: "", limit: 100, want: []string{""}},
+		{text: "   ", limit: 10, want: []string{""}},
+		{text: "First one. Second one.", limit: 15, want: []string{"First one.", "Second one."}},
+		{text: "Line one\nline two", limit: 12, want: []string{"Line one", "line two"}},
+		{text: "alpha beta gamma", limit: 12, want: []string{"alpha beta", "gamma"}},
+		{text: "abcdefghij", limit: 4, want: []string{"abcd", "efgh", "ij"}},
+		{text: "Olá, tudo bem? Sim.", limit: 15, want: []string{"Olá, tudo bem?", "Sim."}},
+	}
+	for _, tt := range tests {
+		got := SplitTranscript(tt.text, tt.limit)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitTranscript(%q, %d) = %q, want %q", tt.text, tt.limit, got, tt.want)
+		}
+		for _, part := range got {
+			if tt.limit > 0 && len([]rune(part)) > tt.limit {
+				t.Errorf("SplitTranscript(%q, %d) returned part %q over the limit", tt.text, tt.limit, part)
+			}
+		}
+	}
+}
+
+func TestSplitTranscriptKeepsText(t *testing.T) {
+	text := strings.Repeat("Some words in a sentence. ", 50)
+	parts := SplitTranscript(text, 100)
+	if got, want := strings.Join(strings.Fields(strings.Join(parts, " ")), " "), strings.Join(strings.Fields(text), " "); got != want {
+		t.Errorf("Joined parts differ from the text:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFormatTranscript(t *testing.T) {
+	tests := []struct {
+		text  string
+		style Style
+		want  string
+	}{
+		{text: "Hello", style: StyleItalic, want: "_Hello_"},
+		{text: "Hello\n\n there ", style: StyleItalic, want: "_Hello_\n\n_there_"},
+		{text: "Hello\nthere", style: StyleQuote, want: "> Hello\n> there"},
+		{text: " Hello ", style: StylePlain, want: "Hello"},
+		{text: "Hello", style: StyleMonospace, want: "```Hello```"},
+		{text: "*bold* _it_ ~s~ `c`", style: StylePlain, want: "∗bold∗ ＿it＿ ∼s∼ ˋcˋ"},
+	}
+	for _, tt := range tests {
+		if got := FormatTranscript(tt.text, tt.style); got != tt.want {
+			t.Errorf("FormatTranscript(%q, %q) = %q, want %q", tt.text, tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestComposeTranscript(t *testing.T) {
+	tests := []struct {
+		text  string
+		style Style
+		want  string
+	}{
+		{text: "Hello", style: StyleItalic, want: "(1/2) _Hello_"},
+		{text: "Hello", style: StylePlain, want: "(1/2) Hello"},
+		{text: "Hello\nthere", style: StyleItalic, want: "(1/2)\n_Hello_\n_there_"},
+		{text: "Hello", style: StyleQuote, want: "(1/2)\n> Hello"},
+	}
+	for _, tt := range tests {
+		if got := composeTranscript("(1/2)", tt.text, tt.style); got != tt.want {
+			t.Errorf("composeTranscript(%q, %q) = %q, want %q", tt.text, tt.style, got, tt.want)
+		}
+	}
+}
@@ -2,17 +2,23 @@ package transcription
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"go.mau.fi/whatsmeow"
 	"go.mau.fi/whatsmeow/binary/proto"
+	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+
+	"whatsapp-transcriber-go/internal/locale"
 )
 
 // DownloadableMessage is an interface that represents a message that can be downloaded.
@@ -32,29 +38,171 @@ type Transcriber interface {
 	TranscribeAudio(ctx context.Context, audioFilePath string, language string) (string, error)
 }
 
+// Translator is implemented by transcribers that can translate speech into English text.
+type Translator interface {
+	TranslateAudio(ctx context.Context, audioFilePath string) (string, error)
+}
+
+// Quota limits the seconds of audio transcribed for a job.
+type Quota interface {
+	// Reserve counts seconds of audio against the quota if they fit. When they don't, it returns false
+	// and the data of the "quota.reached" message.
+	Reserve(seconds int) (locale.Data, bool)
+	// Refund gives back the reserved seconds, for audio that could not be transcribed.
+	Refund()
+}
+
+// ErrTooLong is returned by HandleAudioMessage for audio longer than the job's MaxSeconds.
+var ErrTooLong = errors.New("audio exceeds the maximum duration")
+
+// ErrQuotaReached is returned by HandleAudioMessage when the audio would exceed the job's Quota.
+var ErrQuotaReached = errors.New("transcription quota reached")
+
 // Job handles the transcription of a single audio message.
 type Job struct {
-	Client    *whatsmeow.Client
-	Message   *events.Message
-	Logger    *zap.Logger
-	Transcriber Transcriber
-	Language  string
+	Client            *whatsmeow.Client
+	Message           *events.Message
+	Logger            *zap.Logger
+	Transcriber       Transcriber
+	Language          string
+	Timeout           time.Duration // Deadline for downloading and transcribing, zero for none
+	Late              bool          // Received while the bot was offline, annotated in the reply
+	Reactions         bool          // React to the audio with progress emojis
+	Presence          bool          // Show the composing presence while transcribing
+	MaxLength         int           // Transcripts longer than this many characters are split into parts, zero for no limit
+	DocumentThreshold int           // Transcripts longer than this many characters are sent as a document, zero to never
+	DocumentFormat    string        // Document format, "txt" or "md"
+	Style             Style         // Formatting of the transcript text
+	ChunkSeconds      int           // Audio longer than this is transcribed in chunks with progressive replies, zero to disable
+	Digest            *Digest       // When set, the transcript is delivered to the digest instead of replied directly
+	Catalog           *locale.Catalog
+	Locale            string // Locale of bot-generated messages
+	Provider          string // Name of the transcription provider, available to message templates
+	Translate         string // Language to translate the transcript into, empty for none; only "en" is supported
+	MaxSeconds        int    // Audio longer than this is not transcribed, zero for no limit
+	Quota             Quota  // Reserved before calling the provider and refunded on failure, nil for no limit
 }
 
 // NewJob creates a new TranscriptionJob.
 func NewJob(cli *whatsmeow.Client, msg *events.Message, logger *zap.Logger, transcriber Transcriber, lang string) *Job {
 	return &Job{
-		Client:    cli,
-		Message:   msg,
-		Logger:    logger,
+		Client:      cli,
+		Message:     msg,
+		Logger:      logger,
 		Transcriber: transcriber,
-		Language:  lang,
+		Language:    lang,
+		Style:       StyleItalic,
+	}
+}
+
+// EstimatedSeconds returns the expected audio duration, used to schedule short voice notes first.
+// When the message carries no duration, it is estimated from the file size assuming Opus at ~16 kbit/s.
+func (j *Job) EstimatedSeconds() int {
+	audio := j.Message.Message.GetAudioMessage()
+	if audio == nil {
+		return 0
+	}
+	if seconds := audio.GetSeconds(); seconds > 0 {
+		return int(seconds)
+	}
+	return int(audio.GetFileLength() / 2000)
+}
+
+// QuotedAudioEvent builds a message event for the audio quoted by a reply, so it can be transcribed
+// as if it had just been received. It returns false if the message does not quote an audio message.
+func QuotedAudioEvent(reply *events.Message) (*events.Message, bool) {
+	contextInfo := reply.Message.GetExtendedTextMessage().GetContextInfo()
+	quoted := contextInfo.GetQuotedMessage()
+	if quoted.GetAudioMessage() == nil || contextInfo.GetStanzaID() == "" {
+		return nil, false
+	}
+
+	sender := reply.Info.Chat
+	if participant := contextInfo.GetParticipant(); participant != "" {
+		if jid, err := types.ParseJID(participant); err == nil {
+			sender = jid
+		}
+	}
+
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:    reply.Info.Chat,
+			Sender:  sender,
+			IsGroup: reply.Info.IsGroup,
+		},
+		ID:        contextInfo.GetStanzaID(),
+		Type:      "media",
+		Timestamp: reply.Info.Timestamp,
+	}
+	return &events.Message{Info: info, Message: quoted}, true
+}
+
+// PendingJob is the serializable form of a Job, used to resume jobs interrupted by shutdown.
+type PendingJob struct {
+	Info    types.MessageInfo `json:"info"`
+	Message []byte            `json:"message"` // Protobuf-encoded message
+}
+
+// Pending returns the serializable form of the job.
+func (j *Job) Pending() (*PendingJob, error) {
+	data, err := protobuf.Marshal(j.Message.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return &PendingJob{Info: j.Message.Info, Message: data}, nil
+}
+
+// Event rebuilds the message event the pending job was created from.
+func (p *PendingJob) Event() (*events.Message, error) {
+	msg := &proto.Message{}
+	if err := protobuf.Unmarshal(p.Message, msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
 	}
+	return &events.Message{Info: p.Info, Message: msg}, nil
 }
 
 // HandleAudioMessage orchestrates the audio processing workflow.
-func (j *Job) HandleAudioMessage(ctx context.Context) {
+// It returns an error wrapping ctx.Err() if the job was interrupted by cancellation.
+func (j *Job) HandleAudioMessage(ctx context.Context) (err error) {
 	j.Logger.Info("Starting audio message processing", zap.String("from", j.Message.Info.Sender.String()))
+	if j.Digest != nil {
+		defer j.Digest.Done(j.Message.Info.Chat)
+	}
+	if j.MaxSeconds > 0 && j.EstimatedSeconds() > j.MaxSeconds {
+		j.Logger.Info("Skipping audio longer than the maximum duration", zap.Int("seconds", j.EstimatedSeconds()), zap.Int("max", j.MaxSeconds))
+		j.replyWithError(ctx, j.text("error.too_long", locale.Data{"Max": formatDuration(j.MaxSeconds)}))
+		return ErrTooLong
+	}
+	if j.Quota != nil {
+		if data, ok := j.Quota.Reserve(j.EstimatedSeconds()); !ok {
+			j.Logger.Info("Skipping audio over the transcription quota", zap.Int("seconds", j.EstimatedSeconds()))
+			j.replyWithError(ctx, j.text("quota.reached", data))
+			return ErrQuotaReached
+		}
+		defer func() {
+			if err != nil {
+				j.Quota.Refund()
+			}
+		}()
+	}
+
+	// Show progress on the original audio. The final reaction is sent even if ctx was cancelled.
+	j.react(ctx, reactionWorking)
+	defer func() {
+		if err != nil {
+			j.react(context.Background(), reactionFailed)
+		} else {
+			j.react(context.Background(), reactionDone)
+		}
+	}()
+
+	// Replies use ctx, while the work itself is bound by the job deadline
+	workCtx := ctx
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		workCtx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
 
 	var downloadable whatsmeow.DownloadableMessage
 	if j.Message.Message.GetAudioMessage() != nil {
@@ -67,31 +215,38 @@ func (j *Job) HandleAudioMessage(ctx context.Context) {
 		downloadable = j.Message.Message.GetImageMessage()
 	} else {
 		j.Logger.Error("Message is not a downloadable type", zap.String("from", j.Message.Info.Sender.String()))
-		return
+		return fmt.Errorf("message is not a downloadable type")
 	}
 
 	// Download media
-	data, err := j.Client.Download(ctx, downloadable)
+	data, err := j.Client.Download(workCtx, downloadable)
 	if err != nil {
 		j.Logger.Error("Failed to download audio", zap.Error(err), zap.String("from", j.Message.Info.Sender.String()))
-		j.replyWithError(ctx, "Failed to download audio.")
-		return
+		if ctx.Err() != nil {
+			return fmt.Errorf("download interrupted: %w", ctx.Err())
+		}
+		if workCtx.Err() != nil {
+			j.replyWithError(ctx, j.text("error.download_timeout", nil))
+			return fmt.Errorf("download timed out: %w", workCtx.Err())
+		}
+		j.replyWithError(ctx, j.text("error.download", nil))
+		return fmt.Errorf("failed to download audio: %w", err)
 	}
 
 	// Save to temporary file
 	tempDir := "messages" // Directory to save temporary audio files
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		j.Logger.Error("Failed to create temporary directory", zap.String("path", tempDir), zap.Error(err))
-		j.replyWithError(ctx, "Internal server error: could not create temp directory.")
-		return
+		j.replyWithError(ctx, j.text("error.temp_dir", nil))
+		return fmt.Errorf("failed to create temporary directory: %w", err)
 	}
 
 	tempFileName := filepath.Join(tempDir, fmt.Sprintf("%s-%s.ogg", uuid.New().String(), time.Now().Format("20060102150405")))
 	err = os.WriteFile(tempFileName, data, 0644)
 	if err != nil {
 		j.Logger.Error("Failed to save audio to temporary file", zap.Error(err), zap.String("path", tempFileName))
-		j.replyWithError(ctx, "Internal server error: could not save audio.")
-		return
+		j.replyWithError(ctx, j.text("error.save", nil))
+		return fmt.Errorf("failed to save audio: %w", err)
 	}
 	defer func() {
 		if err := os.Remove(tempFileName); err != nil {
@@ -103,37 +258,172 @@ func (j *Job) HandleAudioMessage(ctx context.Context) {
 
 	j.Logger.Info("Audio saved to temporary file", zap.String("path", tempFileName))
 
+	// Long audio is transcribed in chunks, delivering text as soon as each chunk is done
+	if j.ChunkSeconds > 0 && j.Digest == nil && j.EstimatedSeconds() > j.ChunkSeconds {
+		chunkDir, chunks, err := splitAudio(workCtx, tempFileName, tempDir, j.ChunkSeconds)
+		if err == nil {
+			defer os.RemoveAll(chunkDir)
+			return j.transcribeProgressively(ctx, workCtx, chunks)
+		}
+		j.Logger.Warn("Failed to split audio into chunks, transcribing as a whole", zap.Error(err))
+	}
+
 	// Transcribe audio
-	transcribedText, err := j.Transcriber.TranscribeAudio(ctx, tempFileName, j.Language)
+	stopComposing := j.showComposing()
+	transcribedText, err := j.transcribe(workCtx, tempFileName)
+	stopComposing()
 	if err != nil {
-		j.Logger.Error("Failed to transcribe audio", zap.Error(err), zap.String("from", j.Message.Info.Sender.String()))
-		j.replyWithError(ctx, "Failed to transcribe audio. Please try again later.")
-		return
+		return j.transcriptionFailed(ctx, workCtx, err)
+	}
+	// Silent audio transcribes to nothing, which still gets a reply
+	if strings.TrimSpace(transcribedText) == "" {
+		transcribedText = j.text("transcript.empty", nil)
 	}
 
-	// Reply with transcribed text
+	// Reply with transcribed text, or collect it into the offline digest
+	if j.Digest != nil {
+		j.Digest.Deliver(j.Message.Info.Chat, DigestEntry{
+			Sender:    j.senderName(),
+			Timestamp: j.Message.Info.Timestamp,
+			Text:      transcribedText,
+		})
+		j.Logger.Info("Successfully transcribed into digest", zap.String("from", j.Message.Info.Sender.String()))
+		return nil
+	}
 	j.replyWithText(ctx, transcribedText)
 	j.Logger.Info("Successfully transcribed and replied", zap.String("from", j.Message.Info.Sender.String()))
+	return nil
+}
+
+// transcribe converts an audio file to text, translating it when requested and supported by the provider.
+func (j *Job) transcribe(ctx context.Context, path string) (string, error) {
+	if j.Translate != "" && j.Translate != j.Language {
+		if translator, ok := j.Transcriber.(Translator); ok && j.Translate == "en" {
+			return translator.TranslateAudio(ctx, path)
+		}
+		j.Logger.Warn("Translation not supported, transcribing instead", zap.String("provider", j.Provider), zap.String("target", j.Translate))
+	}
+	return j.Transcriber.TranscribeAudio(ctx, path, j.Language)
+}
+
+// transcribeProgressively transcribes the chunks in order, updating a progressive reply after each one.
+func (j *Job) transcribeProgressively(ctx, workCtx context.Context, chunks []string) error {
+	j.Logger.Info("Transcribing audio in chunks", zap.Int("chunks", len(chunks)))
+	stopComposing := j.showComposing()
+	defer stopComposing()
+
+	reply := &progressiveReply{job: j}
+	for _, chunk := range chunks {
+		text, err := j.transcribe(workCtx, chunk)
+		if err != nil {
+			reply.finish(ctx, false)
+			return j.transcriptionFailed(ctx, workCtx, err)
+		}
+		reply.add(ctx, text)
+	}
+	reply.finish(ctx, true)
+
+	j.Logger.Info("Successfully transcribed and replied progressively", zap.String("from", j.Message.Info.Sender.String()))
+	return nil
+}
+
+// transcriptionFailed logs a transcription error, replies to the user unless the job was interrupted,
+// and returns the error to report from HandleAudioMessage.
+func (j *Job) transcriptionFailed(ctx, workCtx context.Context, err error) error {
+	j.Logger.Error("Failed to transcribe audio", zap.Error(err), zap.String("from", j.Message.Info.Sender.String()))
+	if ctx.Err() != nil {
+		return fmt.Errorf("transcription interrupted: %w", ctx.Err())
+	}
+	if workCtx.Err() != nil {
+		j.replyWithError(ctx, j.text("error.transcribe_timeout", nil))
+		return fmt.Errorf("transcription timed out: %w", workCtx.Err())
+	}
+	j.replyWithError(ctx, j.text("error.transcribe", nil))
+	return fmt.Errorf("failed to transcribe audio: %w", err)
 }
 
 func (j *Job) replyWithText(ctx context.Context, text string) {
-	// Format the message with prefix in bold and transcription in italics
+	// Format the message with prefix in bold and transcription in the job's style
 	// Trim whitespace to ensure proper WhatsApp formatting
 	trimmedText := strings.TrimSpace(text)
-	formattedText := fmt.Sprintf("*Transcrição automática:* _%s_", trimmedText)
-	_, err := j.Client.SendMessage(ctx, j.Message.Info.Chat, &proto.Message{
-		Conversation: &formattedText,
-	})
-	if err != nil {
-		j.Logger.Error("Failed to send reply message", zap.Error(err), zap.String("to", j.Message.Info.Chat.String()))
+
+	// Very long transcripts are sent as a document, falling back to split messages if that fails
+	if j.DocumentThreshold > 0 && utf8.RuneCountInString(trimmedText) > j.DocumentThreshold {
+		err := j.replyWithDocument(ctx, trimmedText)
+		if err == nil {
+			return
+		}
+		j.Logger.Error("Failed to send transcript as document, splitting instead", zap.Error(err))
+	}
+
+	parts := SplitTranscript(trimmedText, j.MaxLength)
+	for i, part := range parts {
+		formattedText := composeTranscript(j.prefix(i+1, len(parts)), part, j.Style)
+		_, err := j.Client.SendMessage(ctx, j.Message.Info.Chat, j.quotedReply(formattedText))
+		if err != nil {
+			j.Logger.Error("Failed to send reply message", zap.Error(err), zap.String("to", j.Message.Info.Chat.String()))
+			return
+		}
+	}
+}
+
+// prefix returns the bold header of a transcript reply. Part numbers are shown when total is above one.
+func (j *Job) prefix(part, total int) string {
+	return j.text("transcript.header", locale.Data{"Late": j.Late, "Part": part, "Total": total})
+}
+
+// text renders a localized message. Sender, duration, language and provider are always available to the template.
+func (j *Job) text(key string, data locale.Data) string {
+	values := locale.Data{
+		"Sender":   j.senderName(),
+		"Duration": formatDuration(j.EstimatedSeconds()),
+		"Language": j.Language,
+		"Provider": j.Provider,
+	}
+	for name, value := range data {
+		values[name] = value
 	}
+	return j.Catalog.Render(j.Locale, key, values)
+}
+
+// formatDuration formats seconds as m:ss.
+func formatDuration(seconds int) string {
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
 }
 
 func (j *Job) replyWithError(ctx context.Context, errorMessage string) {
-	_, err := j.Client.SendMessage(ctx, j.Message.Info.Chat, &proto.Message{
-		Conversation: &errorMessage,
-	})
+	if j.Digest != nil {
+		j.Digest.Deliver(j.Message.Info.Chat, DigestEntry{
+			Sender:    j.senderName(),
+			Timestamp: j.Message.Info.Timestamp,
+			Failed:    true,
+		})
+		return
+	}
+	_, err := j.Client.SendMessage(ctx, j.Message.Info.Chat, j.quotedReply(errorMessage))
 	if err != nil {
 		j.Logger.Error("Failed to send error reply message", zap.Error(err), zap.String("to", j.Message.Info.Chat.String()))
 	}
-}
\ No newline at end of file
+}
+
+// quotedReply builds a text message quoting the original audio, so it is clear which voice note it refers to.
+func (j *Job) quotedReply(text string) *proto.Message {
+	return &proto.Message{
+		ExtendedTextMessage: &proto.ExtendedTextMessage{
+			Text: &text,
+			ContextInfo: &proto.ContextInfo{
+				StanzaID:      &j.Message.Info.ID,
+				Participant:   protobuf.String(j.Message.Info.Sender.ToNonAD().String()),
+				QuotedMessage: j.Message.Message,
+			},
+		},
+	}
+}
+
+// senderName returns the sender's push name, falling back to their phone number.
+func (j *Job) senderName() string {
+	if j.Message.Info.PushName != "" {
+		return j.Message.Info.PushName
+	}
+	return j.Message.Info.Sender.User
+}